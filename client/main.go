@@ -8,14 +8,15 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
+	"medium-opentelemetry-poc/lib/env"
 	"medium-opentelemetry-poc/lib/tracing"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 )
 
 // This is just for automating the curl command and I'm exporting traces straightly to the jaeger collector
@@ -27,16 +28,13 @@ const (
 )
 
 func main() {
-	jaegerCollectorURL := getenv("JAEGER_COLLECTOR_URL", "http://localhost:14268/api/traces")
-	serverURL := getenv("SERVER_URL", "http://localhost:8080/sayHello/hashem")
-	jaegerAgenthost := getenv("JAEGER_AGENT_NAME", "localhost")
-	jaegerAgentport := getenv("JAEGER_AGENT_PORT", "5775")
+	serverURL := env.Get("SERVER_URL", "http://localhost:8080/sayHello/hashem")
 
 	// tracing.TracerProvider returns an OpenTelemetry TracerProvider configured to use
-	// the Jaeger exporter that will send spans to the provided url. The returned
+	// the Jaeger exporter that will send spans to the agent or the collector (JAEGER_EXPORT_MODE). The returned
 	// TracerProvider will also use a Resource configured with all the information
 	// about the application.
-	tp, err := tracing.TracerProvider(jaegerCollectorURL, jaegerAgenthost, jaegerAgentport, service, environment, id)
+	tp, err := tracing.TracerProvider(tracing.JaegerEndpointFromEnv(), service, environment, id)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -46,7 +44,12 @@ func main() {
 	// SetTracerProvider registers `tp` as the global trace provider.
 	otel.SetTracerProvider(tp)
 	// SetTextMapPropagator sets propagator as the global TextMapPropagator.
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	// The same as the services (OTEL_PROPAGATORS), so the request joins their trace
+	propagator, err := tracing.PropagatorFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	otel.SetTextMapPropagator(propagator)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -74,6 +77,8 @@ func requestInit(ctx context.Context, url *string) {
 	// To have sperated span (child span):
 	// we can comment the code below to have the current extra information as part of
 	// the span which already began by plugin
+	// the user of the request goes along as baggage, the services copy it onto their spans
+	ctx = baggage.ContextWithValues(ctx, attribute.String("username", env.Get("CLIENT_USERNAME", "donuts")))
 	ctx, span := otel.Tracer("Client").Start(ctx, "requestInit")
 	log.Printf("TraceID=%t", span.SpanContext().HasTraceID())
 	log.Printf("TraceID=%s", span.SpanContext().TraceID())
@@ -106,11 +111,3 @@ func DoWithClient(req *http.Request, client *http.Client) ([]byte, error) {
 
 	return body, nil
 }
-
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
-	}
-	return value
-}
@@ -6,23 +6,14 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"os"
-	"time"
 
+	"medium-opentelemetry-poc/lib/env"
+	"medium-opentelemetry-poc/lib/fault"
+	"medium-opentelemetry-poc/lib/health"
+	"medium-opentelemetry-poc/lib/server"
 	"medium-opentelemetry-poc/lib/tracing"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
-	"go.opentelemetry.io/otel/propagation"
-	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
-	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
-	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	"go.opentelemetry.io/otel/semconv"
 )
 
 const (
@@ -34,30 +25,40 @@ const (
 var tracer = otel.Tracer("formatter-service")
 
 func main() {
+	// Important to defer the cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// We have two configuration, either using otel collector as agent/collector
-	// or using the jaeger agent/collector, to export traces to
-	tracingOption := getenv("TRACING_OPTION", "otel-collector")
+	// or using the jaeger agent/collector, to export traces (TRACING_OPTION)
+	opts := tracing.OptionsFromEnv(service, environment, id)
+	shutdown, err := tracing.Setup(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if tracingOption == "otel-collector" {
-		initProvider()
-	} else if tracingOption == "jaeger-collector" {
-		initProviderJaeger()
+	// errors and latency injected on purpose, none unless configured (FAULT_INJECTION_*)
+	faults, err := fault.InjectorFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	// Cleanly shutdown and flush telemetry when the application exits.
-	defer func(ctx context.Context) {
-		// Do not make the application hang when it is shutdown.
-		ctx, cancel = context.WithTimeout(ctx, time.Second*5)
-		defer cancel()
-	}(ctx)
-
-	wrappedHandler := otelhttp.NewHandler(http.HandlerFunc(handleFormatGreeting), "/formatGreeting/")
+	wrappedHandler := tracing.NewHandler(faults.Wrap(http.HandlerFunc(handleFormatGreeting), "/formatGreeting/"), "/formatGreeting/")
 	http.Handle("/formatGreeting/", wrappedHandler)
 
-	log.Print("Listening on :8082/")
-	log.Fatal(http.ListenAndServe(":8082", nil))
+	// /healthz and /readyz, not traced
+	checker := &health.Checker{}
+	if check := tracing.ExporterCheck(opts); check != nil {
+		checker.AddOptional("exporter", check)
+	}
+	health.Register(http.DefaultServeMux, checker)
+
+	srv := &http.Server{Addr: env.Get("PORT", ":8082")}
+
+	// Serve until SIGTERM, then drain the requests and flush the telemetry before exiting
+	if err := server.Run(ctx, srv, server.ShutdownTimeoutFromEnv(), shutdown); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func handleFormatGreeting(w http.ResponseWriter, r *http.Request) {
@@ -90,83 +91,3 @@ func FormatGreeting(ctx context.Context, name, title, description string) string
 	}
 	return response
 }
-
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
-	}
-	return value
-}
-
-func initProvider() {
-	log.Print("initStarted")
-	ctx := context.Background()
-
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		// setting default endpoint for exporter
-		// in case of sidecar gonna work as well
-		endpoint = "127.0.0.1:4317"
-	}
-
-	// Create new OTLP Exporter
-	driver := otlpgrpc.NewDriver(
-		otlpgrpc.WithInsecure(),
-		otlpgrpc.WithEndpoint(endpoint),
-		otlpgrpc.WithDialOption(), // useful for testing
-	)
-	exporter, err := otlp.NewExporter(ctx, driver)
-	handleErr(err, "failed to create new OTLP exporter")
-
-	idg := xray.NewIDGenerator()
-
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String("formatter"),
-		),
-	)
-	handleErr(err, "failed to create resource")
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSyncer(exporter),
-		sdktrace.WithIDGenerator(idg),
-	)
-
-	cont := controller.New(
-		processor.New(
-			simple.NewWithExactDistribution(),
-			exporter,
-		),
-		controller.WithExporter(exporter),
-		controller.WithCollectPeriod(2*time.Second),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(xray.Propagator{})
-	// if you want to set Meter
-	// global.SetMeterProvider(cont.MeterProvider())
-	_ = cont.Start(ctx)
-}
-
-func initProviderJaeger() {
-	jaegerCollectorURL := getenv("JAEGER_COLLECTOR_URL", "http://localhost:14268/api/traces")
-	jaegerAgenthost := getenv("JAEGER_AGENT_NAME", "localhost")
-	jaegerAgentport := getenv("JAEGER_AGENT_PORT", "5775")
-	tp, err := tracing.TracerProvider(jaegerCollectorURL, jaegerAgenthost, jaegerAgentport, service, environment, id)
-	if err != nil {
-		log.Fatal(err)
-	}
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-
-}
-
-func handleErr(err error, message string) {
-	if err != nil {
-		log.Fatalf("%s: %v", message, err)
-	}
-}
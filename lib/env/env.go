@@ -0,0 +1,61 @@
+// Package env reads the settings of the services from the environment variables.
+// A variable which is not set, or can't be parsed, gives the fallback (the latter is logged).
+package env
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Get returns the value of key, fallback if it is not set.
+func Get(key, fallback string) string {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	return value
+}
+
+// Int returns the integer of key.
+func Int(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using %d: %v", key, value, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+// Float returns the number of key.
+func Float(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("invalid %s %q, using %g: %v", key, value, fallback, err)
+		return fallback
+	}
+	return f
+}
+
+// Duration returns the duration of key, e.g. "250ms".
+func Duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid %s %q, using %s: %v", key, value, fallback, err)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,280 @@
+// Package fault injects failures (errors and latency) in the http handlers of the services,
+// to see how the traces, the metrics and the alerts look like when things go wrong.
+// Nothing is injected unless it is configured: rules in FAULT_INJECTION_RULES (or the file
+// FAULT_INJECTION_FILE), and the X-Inject-Fault request header once FAULT_INJECTION_HEADER=true.
+// Every injected fault is tagged on the span of the request (fault.* attributes).
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"medium-opentelemetry-poc/lib/random"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header asks for a fault on a single request, e.g. "status=503" or "delay=300ms, status=500".
+// It is only honored when the injector allows it (FAULT_INJECTION_HEADER=true).
+const Header = "X-Inject-Fault"
+
+// AllRoutes is the route of the rules applied to every handler
+const AllRoutes = "*"
+
+// The attributes of the injected faults, on the span of the request
+const (
+	injectedKey   = attribute.Key("fault.injected")
+	sourceKey     = attribute.Key("fault.source")
+	delayKey      = attribute.Key("fault.delay_ms")
+	statusCodeKey = attribute.Key("fault.status_code")
+)
+
+// The values of fault.source
+const (
+	sourceRule   = "rule"
+	sourceHeader = "header"
+)
+
+// errInjected is recorded on the span of the requests failed on purpose
+var errInjected = errors.New("injected fault")
+
+// Duration is a time.Duration written as a string in JSON (e.g. "250ms")
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, expected a string like \"250ms\"", b)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule injects faults in a fraction of the requests of a route. For example, one request
+// out of ten of /sayHello/ fails with 503 and all of them are slowed down by 200ms:
+//
+//	[{"route": "/sayHello/", "error_rate": 0.1, "status_code": 503, "latency": "200ms"}]
+type Rule struct {
+	// Route is the route the handler is registered on (e.g. "/getPerson/"), AllRoutes for all
+	Route string `json:"route"`
+	// ErrorRate is the fraction of the requests answered with StatusCode (0 to 1)
+	ErrorRate float64 `json:"error_rate"`
+	// StatusCode of the failed requests, 500 if not set
+	StatusCode int `json:"status_code"`
+	// Latency is added to the requests before they are handled (or failed)
+	Latency Duration `json:"latency"`
+	// LatencyRate is the fraction of the requests slowed down by Latency, all of them if not set
+	LatencyRate float64 `json:"latency_rate"`
+}
+
+func (r Rule) validate() error {
+	if r.Route == "" {
+		return errors.New("the route of the rule is required")
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 || r.LatencyRate < 0 || r.LatencyRate > 1 {
+		return fmt.Errorf("the rates of the rule of %s must be between 0 and 1", r.Route)
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 400 || r.StatusCode > 599) {
+		return fmt.Errorf("the status code of the rule of %s must be a 4xx or a 5xx, got %d", r.Route, r.StatusCode)
+	}
+	if r.Latency < 0 {
+		return fmt.Errorf("the latency of the rule of %s must be positive", r.Route)
+	}
+	return nil
+}
+
+// Injector wraps the handlers to inject the faults of its rules and of the request header.
+// A nil or empty Injector leaves the handlers as they are.
+type Injector struct {
+	rules       []Rule
+	allowHeader bool
+}
+
+// NewInjector creates an Injector of rules, which honors the X-Inject-Fault header if allowHeader.
+func NewInjector(rules []Rule, allowHeader bool) (*Injector, error) {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Injector{
+		rules:       rules,
+		allowHeader: allowHeader,
+	}, nil
+}
+
+// InjectorFromEnv creates the Injector set in the environment variables: the JSON rules of
+// FAULT_INJECTION_RULES, or of the file FAULT_INJECTION_FILE, and FAULT_INJECTION_HEADER.
+func InjectorFromEnv() (*Injector, error) {
+	raw := os.Getenv("FAULT_INJECTION_RULES")
+	if path := os.Getenv("FAULT_INJECTION_FILE"); raw == "" && path != "" {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(bytes)
+	}
+	var rules []Rule
+	if strings.TrimSpace(raw) != "" {
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rules); err != nil {
+			return nil, fmt.Errorf("invalid fault injection rules: %w", err)
+		}
+	}
+	allowHeader, _ := strconv.ParseBool(os.Getenv("FAULT_INJECTION_HEADER"))
+	inj, err := NewInjector(rules, allowHeader)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 || allowHeader {
+		log.Printf("fault injection enabled: %d rules, header %t", len(rules), allowHeader)
+	}
+	return inj, nil
+}
+
+// Wrap returns handler with the faults of route injected. It has to be wrapped for tracing
+// (tracing.NewHandler) so the faults are tagged on the span of the request.
+func (inj *Injector) Wrap(handler http.Handler, route string) http.Handler {
+	if inj == nil {
+		return handler
+	}
+	var rules []Rule
+	for _, rule := range inj.rules {
+		if rule.Route == route || rule.Route == AllRoutes {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 && !inj.allowHeader {
+		return handler
+	}
+	return &faultHandler{handler: handler, injector: inj, rules: rules}
+}
+
+// fault is what is injected in a request
+type fault struct {
+	source     string
+	delay      time.Duration
+	statusCode int
+}
+
+type faultHandler struct {
+	handler  http.Handler
+	injector *Injector
+	rules    []Rule
+}
+
+func (h *faultHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f, err := h.fault(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.delay == 0 && f.statusCode == 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	attrs := []attribute.KeyValue{injectedKey.Bool(true), sourceKey.String(f.source)}
+	if f.delay > 0 {
+		attrs = append(attrs, delayKey.Int64(f.delay.Milliseconds()))
+	}
+	if f.statusCode > 0 {
+		attrs = append(attrs, statusCodeKey.Int(f.statusCode))
+	}
+	span.SetAttributes(attrs...)
+	span.AddEvent("fault injected", trace.WithAttributes(attrs...))
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-r.Context().Done():
+			// the client gave up, no need to answer
+			return
+		}
+	}
+	if f.statusCode == 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	span.RecordError(errInjected)
+	if f.statusCode >= 500 {
+		span.SetStatus(codes.Error, errInjected.Error())
+	}
+	http.Error(w, fmt.Sprintf("%s (%d)", errInjected, f.statusCode), f.statusCode)
+}
+
+// fault returns the fault to inject in r: the one of the header if any, else the rules are rolled.
+func (h *faultHandler) fault(r *http.Request) (fault, error) {
+	if value := r.Header.Get(Header); value != "" && h.injector.allowHeader {
+		f, err := parseHeader(value)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s header: %w", Header, err)
+		}
+		f.source = sourceHeader
+		return f, nil
+	}
+
+	f := fault{source: sourceRule}
+	for _, rule := range h.rules {
+		if rule.Latency > 0 && (rule.LatencyRate == 0 || roll(rule.LatencyRate)) {
+			f.delay += time.Duration(rule.Latency)
+		}
+		if f.statusCode == 0 && rule.ErrorRate > 0 && roll(rule.ErrorRate) {
+			f.statusCode = rule.StatusCode
+			if f.statusCode == 0 {
+				f.statusCode = http.StatusInternalServerError
+			}
+		}
+	}
+	return f, nil
+}
+
+// roll tells whether a request out of the given fraction is picked
+func roll(rate float64) bool {
+	return random.Float64() < rate
+}
+
+// parseHeader parses the X-Inject-Fault header: comma separated status=<code> and delay=<duration>
+func parseHeader(value string) (fault, error) {
+	var f fault
+	for _, part := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return f, fmt.Errorf("expected key=value, got %q", part)
+		}
+		switch key, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]); key {
+		case "status":
+			code, err := strconv.Atoi(v)
+			if err != nil || code < 400 || code > 599 {
+				return f, fmt.Errorf("the status must be a 4xx or a 5xx, got %q", v)
+			}
+			f.statusCode = code
+		case "delay":
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return f, fmt.Errorf("invalid delay %q", v)
+			}
+			f.delay = d
+		default:
+			return f, fmt.Errorf("unknown key %q, expected status or delay", key)
+		}
+	}
+	return f, nil
+}
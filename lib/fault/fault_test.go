@@ -0,0 +1,270 @@
+package fault
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setenv sets key for the test (t.Setenv needs go 1.17)
+func setenv(t *testing.T, key, value string) {
+	old, had := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// serve sends a request with the fault header (if not empty) to the handler of route
+// wrapped by inj, within a span, and returns the response and the span
+func serve(t *testing.T, inj *Injector, route, header string) (*httptest.ResponseRecorder, *sdktrace.SpanSnapshot) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+
+	req := httptest.NewRequest(http.MethodGet, route, nil)
+	if header != "" {
+		req.Header.Set(Header, header)
+	}
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	rec := httptest.NewRecorder()
+	inj.Wrap(ok, route).ServeHTTP(rec, req.WithContext(ctx))
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	return rec, spans[0]
+}
+
+func attributes(span *sdktrace.SpanSnapshot) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestInjectorFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.json")
+	if err := ioutil.WriteFile(file, []byte(`[{"route": "/file/", "error_rate": 1}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		rules   string
+		file    string
+		header  string
+		want    []Rule
+		wantErr bool
+	}{
+		{name: "nothing set"},
+		{
+			name:  "rules",
+			rules: `[{"route": "/sayHello/", "error_rate": 0.1, "status_code": 503, "latency": "200ms", "latency_rate": 0.5}]`,
+			want:  []Rule{{Route: "/sayHello/", ErrorRate: 0.1, StatusCode: 503, Latency: Duration(200 * time.Millisecond), LatencyRate: 0.5}},
+		},
+		{name: "file", file: file, want: []Rule{{Route: "/file/", ErrorRate: 1}}},
+		{name: "rules win over the file", rules: `[{"route": "*"}]`, file: file, want: []Rule{{Route: AllRoutes}}},
+		{name: "header only", header: "true"},
+		{name: "missing file", file: filepath.Join(t.TempDir(), "missing.json"), wantErr: true},
+		{name: "invalid json", rules: `{"route": "/"}`, wantErr: true},
+		{name: "unknown field", rules: `[{"route": "/", "rate": 1}]`, wantErr: true},
+		{name: "invalid duration", rules: `[{"route": "/", "latency": 200}]`, wantErr: true},
+		{name: "rate above 1", rules: `[{"route": "/", "error_rate": 2}]`, wantErr: true},
+		{name: "status not an error", rules: `[{"route": "/", "status_code": 200}]`, wantErr: true},
+		{name: "no route", rules: `[{"error_rate": 1}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "FAULT_INJECTION_RULES", tt.rules)
+			setenv(t, "FAULT_INJECTION_FILE", tt.file)
+			setenv(t, "FAULT_INJECTION_HEADER", tt.header)
+
+			inj, err := InjectorFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(inj.rules) != len(tt.want) {
+				t.Fatalf("expected the rules %+v, got %+v", tt.want, inj.rules)
+			}
+			for i := range tt.want {
+				if inj.rules[i] != tt.want[i] {
+					t.Errorf("expected the rule %+v, got %+v", tt.want[i], inj.rules[i])
+				}
+			}
+			if inj.allowHeader != (tt.header == "true") {
+				t.Errorf("expected the header to be allowed: %t", tt.header == "true")
+			}
+		})
+	}
+}
+
+func TestHeaderIsOptIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowHeader bool
+		header      string
+		wantStatus  int
+	}{
+		{name: "ignored when not allowed", header: "status=503", wantStatus: http.StatusOK},
+		{name: "status", allowHeader: true, header: "status=503", wantStatus: http.StatusServiceUnavailable},
+		{name: "delay only", allowHeader: true, header: "delay=1ms", wantStatus: http.StatusOK},
+		{name: "delay and status", allowHeader: true, header: "delay=1ms, status=404", wantStatus: http.StatusNotFound},
+		{name: "no header", allowHeader: true, wantStatus: http.StatusOK},
+		{name: "invalid status", allowHeader: true, header: "status=200", wantStatus: http.StatusBadRequest},
+		{name: "invalid delay", allowHeader: true, header: "delay=soon", wantStatus: http.StatusBadRequest},
+		{name: "unknown key", allowHeader: true, header: "crash=1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inj, err := NewInjector(nil, tt.allowHeader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec, span := serve(t, inj, "/sayHello/", tt.header)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			injected := attributes(span)[injectedKey].AsBool()
+			if want := tt.wantStatus != http.StatusBadRequest && tt.allowHeader && tt.header != ""; injected != want {
+				t.Errorf("expected fault.injected=%t, got %t", want, injected)
+			}
+			if injected && attributes(span)[sourceKey].AsString() != sourceHeader {
+				t.Errorf("expected the fault to come from the header, got %v", attributes(span)[sourceKey])
+			}
+		})
+	}
+}
+
+func TestRulesOfTheRoute(t *testing.T) {
+	inj, err := NewInjector([]Rule{{Route: "/getPerson/", ErrorRate: 1, StatusCode: 502}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := serve(t, inj, "/getPerson/", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected the rule of the route to fail the request, got %d", rec.Code)
+	}
+	if rec, _ := serve(t, inj, "/sayHello/", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected the other routes to be left alone, got %d", rec.Code)
+	}
+
+	inj, err = NewInjector([]Rule{{Route: AllRoutes, ErrorRate: 1}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, span := serve(t, inj, "/sayHello/", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected the default status 500 on every route, got %d", rec.Code)
+	}
+	if span.StatusCode.String() != "Error" || len(span.MessageEvents) == 0 {
+		t.Errorf("expected the span to be failed with events, got %v %v", span.StatusCode, span.MessageEvents)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	inj, err := NewInjector([]Rule{{Route: AllRoutes, Latency: Duration(50 * time.Millisecond)}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	rec, span := serve(t, inj, "/sayHello/", "")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the request to be delayed by 50ms, took %s", elapsed)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the delayed request to be handled, got %d", rec.Code)
+	}
+	if got := attributes(span)[delayKey].AsInt64(); got != 50 {
+		t.Errorf("expected fault.delay_ms=50, got %d", got)
+	}
+}
+
+func TestLatencyStopsWhenTheClientGivesUp(t *testing.T) {
+	inj, err := NewInjector([]Rule{{Route: AllRoutes, Latency: Duration(time.Minute)}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	handled := false
+	handler := inj.Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { handled = true }), "/")
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the delay to stop with the request, took %s", elapsed)
+	}
+	if handled {
+		t.Error("expected the canceled request not to be handled")
+	}
+}
+
+func TestRates(t *testing.T) {
+	const requests = 5000
+	inj, err := NewInjector([]Rule{{
+		Route: AllRoutes, ErrorRate: 0.2, StatusCode: 503,
+		Latency: Duration(time.Nanosecond), LatencyRate: 0.5,
+	}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := inj.Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), "/").(*faultHandler)
+
+	failed, delayed := 0, 0
+	for i := 0; i < requests; i++ {
+		f, err := handler.fault(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.statusCode == 503 {
+			failed++
+		}
+		if f.delay > 0 {
+			delayed++
+		}
+	}
+	// the bounds are 9 standard deviations away from the rates, this doesn't flake
+	if rate := float64(failed) / requests; rate < 0.15 || rate > 0.25 {
+		t.Errorf("expected about 20%% of the requests to fail, got %.1f%%", rate*100)
+	}
+	if rate := float64(delayed) / requests; rate < 0.43 || rate > 0.57 {
+		t.Errorf("expected about 50%% of the requests to be delayed, got %.1f%%", rate*100)
+	}
+}
+
+func TestNilInjectorLeavesTheHandler(t *testing.T) {
+	handler := http.NewServeMux()
+	var inj *Injector
+	if got := inj.Wrap(handler, "/"); got != handler {
+		t.Error("expected a nil injector not to wrap the handler")
+	}
+	empty, err := NewInjector(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, wrapped := empty.Wrap(handler, "/").(*faultHandler); wrapped {
+		t.Error("expected an injector without rules nor header not to wrap the handler")
+	}
+}
@@ -0,0 +1,182 @@
+// Package health serves the liveness (/healthz) and readiness (/readyz) endpoints of the
+// services. They are not traced: they are hit every few seconds by the orchestrator and
+// would drown the real traces.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout limits every check of the readiness endpoint
+const DefaultTimeout = 2 * time.Second
+
+// The status of the checks and of the service
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check tells whether a dependency of the service is usable, nil if it is.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// Checker runs the checks of the readiness endpoint.
+type Checker struct {
+	// Timeout limits every check, DefaultTimeout if zero
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+// Add adds a check the service needs to be ready.
+func (c *Checker) Add(name string, check Check) {
+	c.add(namedCheck{name: name, check: check})
+}
+
+// AddOptional adds a check which is reported but doesn't make the service unready when it
+// fails, e.g. the telemetry exporter: losing traces is no reason to stop serving.
+func (c *Checker) AddOptional(name string, check Check) {
+	c.add(namedCheck{name: name, check: check, optional: true})
+}
+
+func (c *Checker) add(check namedCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+}
+
+// CheckResult is the outcome of a check, in the JSON of the readiness endpoint.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Optional  bool    `json:"optional,omitempty"`
+}
+
+// Report is the JSON of the health endpoints.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Run runs all the checks concurrently. The service is ready (StatusOK) if none of the
+// required checks failed.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			results[i] = run(ctx, check, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, check := range checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusOK && !check.optional {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, check namedCheck, timeout time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Optional:  check.optional,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Register serves /healthz and /readyz of c on mux.
+// /healthz only tells the process is alive, /readyz runs the checks and answers 503 if one
+// of the required ones fails.
+func Register(mux *http.ServeMux, c *Checker) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Report{Status: StatusOK})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Run(r.Context()))
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(bytes)
+}
+
+// HTTPCheck checks that url answers with a 2xx status code (e.g. the /healthz of a
+// dependency). It uses a plain http client, so the check is not traced.
+func HTTPCheck(url string) Check {
+	client := &http.Client{}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s answered %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// TCPCheck checks that a TCP connection can be opened to addr (host:port).
+func TCPCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,134 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrCircuitOpen is returned by Client.Do while the breaker of the dependency is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerConfig tells when the circuit of a dependency opens.
+type BreakerConfig struct {
+	// FailureThreshold is the number of failed attempts in a row opening the circuit
+	// (0 never opens it)
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a request is let through to
+	// probe the dependency (half-open)
+	Cooldown time.Duration
+}
+
+// DefaultBreakerConfig is used for the settings which are not in the environment variables
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	Cooldown:         10 * time.Second,
+}
+
+// The states of the breaker
+const (
+	// stateClosed lets all the requests through
+	stateClosed = "closed"
+	// stateOpen fails the requests right away, the dependency is left alone for a while
+	stateOpen = "open"
+	// stateHalfOpen lets a single request through, its outcome closes or opens the circuit again
+	stateHalfOpen = "half-open"
+)
+
+// The attributes of the events of the breaker
+const (
+	breakerFromKey = attribute.Key("circuit_breaker.from")
+	breakerToKey   = attribute.Key("circuit_breaker.to")
+)
+
+// breaker is the circuit breaker of a dependency
+type breaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// probing is true while the request of the half-open state is in flight
+	probing bool
+}
+
+func newBreaker(name string, cfg BreakerConfig) *breaker {
+	return &breaker{name: name, cfg: cfg, state: stateClosed}
+}
+
+// allow tells whether a request can be sent, ErrCircuitOpen if it can't
+func (b *breaker) allow(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(ctx, stateHalfOpen)
+		b.probing = true
+		return nil
+	case stateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// success records a request answered by the dependency
+func (b *breaker) success(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != stateClosed {
+		b.setState(ctx, stateClosed)
+	}
+}
+
+// failure records a failed request, it opens the circuit after too many of them
+func (b *breaker) failure(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == stateHalfOpen || (b.cfg.FailureThreshold > 0 && b.failures >= b.cfg.FailureThreshold) {
+		b.openedAt = time.Now()
+		if b.state != stateOpen {
+			b.setState(ctx, stateOpen)
+		}
+	}
+}
+
+// canceled records a request given up before the dependency answered, it tells nothing
+// about the dependency but lets another request probe it in the half-open state
+func (b *breaker) canceled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// setState changes the state, recorded as an event of the span of ctx. The caller holds the lock.
+func (b *breaker) setState(ctx context.Context, state string) {
+	log.Printf("circuit breaker of %s: %s -> %s", b.name, b.state, state)
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker state changed", trace.WithAttributes(
+		peerServiceKey.String(b.name),
+		breakerFromKey.String(b.state),
+		breakerToKey.String(state),
+	))
+	b.state = state
+}
@@ -0,0 +1,268 @@
+// Package httpclient is the client the services use to call their dependencies: one Client
+// per dependency, reused for all the calls, with a timeout per attempt, retries with backoff
+// for the idempotent requests and a circuit breaker.
+// Every attempt has its own span, the retries and the state changes of the breaker are
+// events of the span of the caller.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+	"medium-opentelemetry-poc/lib/random"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config tunes the Client of a dependency.
+type Config struct {
+	// Timeout limits every attempt, reading the body included (0 doesn't limit it)
+	Timeout time.Duration
+	// MaxRetries is how many times a failed idempotent request is retried (0 never retries)
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry, it doubles after every retry up to
+	// MaxBackoff. A random jitter (up to half of it) is taken off.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Breaker opens the circuit when the dependency keeps failing
+	Breaker BreakerConfig
+	// Hedge races a slow idempotent request with a second one
+	Hedge HedgeConfig
+}
+
+// DefaultConfig is used for the settings which are not in the environment variables
+var DefaultConfig = Config{
+	Timeout:        2 * time.Second,
+	MaxRetries:     2,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Breaker:        DefaultBreakerConfig,
+	Hedge:          DefaultHedgeConfig,
+}
+
+// ConfigFromEnv returns the Config of a dependency set in the environment variables named
+// after it, e.g. with the prefix QUERYYER: QUERYYER_TIMEOUT, QUERYYER_MAX_RETRIES,
+// QUERYYER_INITIAL_BACKOFF, QUERYYER_MAX_BACKOFF, QUERYYER_BREAKER_FAILURES, QUERYYER_BREAKER_COOLDOWN,
+// QUERYYER_HEDGE_PERCENTILE and QUERYYER_HEDGE_MIN_DELAY.
+func ConfigFromEnv(prefix string) Config {
+	cfg := DefaultConfig
+	cfg.Timeout = env.Duration(prefix+"_TIMEOUT", cfg.Timeout)
+	cfg.MaxRetries = env.Int(prefix+"_MAX_RETRIES", cfg.MaxRetries)
+	cfg.InitialBackoff = env.Duration(prefix+"_INITIAL_BACKOFF", cfg.InitialBackoff)
+	cfg.MaxBackoff = env.Duration(prefix+"_MAX_BACKOFF", cfg.MaxBackoff)
+	cfg.Breaker.FailureThreshold = env.Int(prefix+"_BREAKER_FAILURES", cfg.Breaker.FailureThreshold)
+	cfg.Breaker.Cooldown = env.Duration(prefix+"_BREAKER_COOLDOWN", cfg.Breaker.Cooldown)
+	cfg.Hedge.Percentile = env.Float(prefix+"_HEDGE_PERCENTILE", cfg.Hedge.Percentile)
+	cfg.Hedge.MinDelay = env.Duration(prefix+"_HEDGE_MIN_DELAY", cfg.Hedge.MinDelay)
+	return cfg
+}
+
+// The attributes of the attempts
+const (
+	attemptKey     = attribute.Key("http.attempt")
+	backoffKey     = attribute.Key("http.retry.backoff_ms")
+	peerServiceKey = attribute.Key("peer.service")
+)
+
+// Response is the answer of the dependency, the body is already read.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Client calls a dependency. It is safe for concurrent use and meant to be shared.
+type Client struct {
+	name    string
+	cfg     Config
+	client  *http.Client
+	breaker *breaker
+	tracer  trace.Tracer
+
+	// mu guards the latencies of the last requests, for the hedging
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+// New creates the Client of the dependency name (e.g. "queryyer"), it's recorded as the
+// peer.service of the attempts and in the events of the breaker.
+func New(name string, cfg Config) *Client {
+	return &Client{
+		name: name,
+		cfg:  cfg,
+		// NewTransport wraps the provided http.RoundTripper with one that starts a span
+		// and injects the span context into the outbound request headers.
+		client:  &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		breaker: newBreaker(name, cfg.Breaker),
+		tracer:  otel.Tracer("medium-opentelemetry-poc/lib/httpclient"),
+	}
+}
+
+// Do sends req, retrying it if it is idempotent and the attempt failed (transport error or
+// 502, 503, 504), and hedging it if the Config says so. Any answer of the dependency is
+// returned as a Response, whatever its status code.
+// It returns ErrCircuitOpen without sending anything while the breaker is open.
+// req must not have a body, it can't be sent again.
+func (c *Client) Do(req *http.Request) (*Response, error) {
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	retries := 0
+	send := func(req *http.Request, attempt int) (*Response, error) {
+		res := c.attempt(req, attempt, nil)
+		return res.resp, res.err
+	}
+	if idempotent(req.Method) {
+		retries = c.cfg.MaxRetries
+		send = c.hedged
+	}
+
+	backoff := c.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := send(req, attempt)
+		if attempt > retries || !retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := c.delay(backoff, resp)
+		span.AddEvent("retrying", trace.WithAttributes(
+			peerServiceKey.String(c.name),
+			attemptKey.Int(attempt),
+			backoffKey.Int64(delay.Milliseconds()),
+		))
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(delay):
+		}
+		if backoff *= 2; backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// attempt sends req once, in its own span and within the timeout.
+// hedge is nil if the attempt is not hedged, else it tells whether it's the hedged request:
+// the span is then left running, hedged ends it once it knows which request won.
+func (c *Client) attempt(req *http.Request, attempt int, hedge *bool) (res result) {
+	ctx, span := c.tracer.Start(req.Context(), c.name+"-attempt", trace.WithAttributes(
+		peerServiceKey.String(c.name),
+		attemptKey.Int(attempt),
+		semconv.HTTPMethodKey.String(req.Method),
+	))
+	res.span = span
+	if hedge == nil {
+		defer span.End()
+	} else {
+		span.SetAttributes(hedgeKey.Bool(*hedge))
+	}
+
+	if err := c.breaker.allow(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "circuit open")
+		res.err = err
+		return res
+	}
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	resp, err := c.send(req.WithContext(ctx))
+	if err != nil && req.Context().Err() != nil {
+		// canceled by the caller, or by the hedging because the other request won: not a
+		// failure of the dependency
+		c.breaker.canceled()
+		span.AddEvent("canceled")
+		res.err = err
+		return res
+	}
+	if err != nil {
+		c.breaker.failure(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request failed")
+		res.err = err
+		return res
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		// the 4xx are answers, only the 5xx tell the dependency is in trouble
+		c.breaker.failure(ctx)
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	} else {
+		c.breaker.success(ctx)
+		c.recordLatency(time.Since(start))
+	}
+	res.resp = resp
+	return res
+}
+
+func (c *Client) send(req *http.Request) (*Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the response: %w", err)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// delay is the wait before the next attempt: the backoff less the jitter, or the Retry-After
+// of the dependency if it asks for longer (up to MaxBackoff)
+func (c *Client) delay(backoff time.Duration, resp *Response) time.Duration {
+	delay := random.Jitter(backoff)
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if after := time.Duration(seconds) * time.Second; after > delay {
+				delay = after
+			}
+			if delay > c.cfg.MaxBackoff {
+				delay = c.cfg.MaxBackoff
+			}
+		}
+	}
+	return delay
+}
+
+// idempotent tells whether a request with method can be sent again safely
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryable tells whether the outcome of an attempt is worth another one
+func retryable(resp *Response, err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,287 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testConfig doesn't wait between the retries and doesn't open the circuit
+var testConfig = Config{
+	Timeout:        time.Second,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+}
+
+// newTestClient returns a Client of cfg whose spans go to the returned exporter
+func newTestClient(cfg Config) (*Client, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	c := New("dependency", cfg)
+	c.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+	return c, exporter
+}
+
+// statusServer answers the statuses in order, the last one repeated, and counts the requests
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&hits, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func do(t *testing.T, ctx context.Context, c *Client, method, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Do(req)
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		wantHits   int32
+		wantStatus int
+	}{
+		{name: "GET is retried on 503", method: http.MethodGet, statuses: []int{503}, wantHits: 3, wantStatus: 503},
+		{name: "GET succeeds on retry", method: http.MethodGet, statuses: []int{502, 200}, wantHits: 2, wantStatus: 200},
+		{name: "GET is retried on 504", method: http.MethodGet, statuses: []int{504, 504, 200}, wantHits: 3, wantStatus: 200},
+		{name: "PUT is retried", method: http.MethodPut, statuses: []int{503, 204}, wantHits: 2, wantStatus: 204},
+		{name: "DELETE is retried", method: http.MethodDelete, statuses: []int{503, 204}, wantHits: 2, wantStatus: 204},
+		{name: "POST is never retried", method: http.MethodPost, statuses: []int{503, 201}, wantHits: 1, wantStatus: 503},
+		{name: "PATCH is never retried", method: http.MethodPatch, statuses: []int{502, 200}, wantHits: 1, wantStatus: 502},
+		{name: "500 is not retried", method: http.MethodGet, statuses: []int{500, 200}, wantHits: 1, wantStatus: 500},
+		{name: "404 is not retried", method: http.MethodGet, statuses: []int{404, 200}, wantHits: 1, wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			cfg.MaxRetries = 2
+			c, _ := newTestClient(cfg)
+			srv, hits := statusServer(t, tt.statuses...)
+
+			resp, err := do(t, context.Background(), c, tt.method, srv.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if got := atomic.LoadInt32(hits); got != tt.wantHits {
+				t.Errorf("expected %d requests, got %d", tt.wantHits, got)
+			}
+		})
+	}
+}
+
+func TestRetriesOnTransportErrors(t *testing.T) {
+	srv, _ := statusServer(t, 200)
+	srv.Close()
+	cfg := testConfig
+	cfg.MaxRetries = 2
+	c, exporter := newTestClient(cfg)
+
+	if _, err := do(t, context.Background(), c, http.MethodGet, srv.URL); err == nil {
+		t.Fatal("expected the error of the closed server")
+	}
+	if got := len(exporter.GetSpans()); got != 3 {
+		t.Errorf("expected 3 attempt spans, got %d", got)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		backoff    time.Duration
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{name: "jitter takes up to half off", backoff: 100 * time.Millisecond, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "a shorter Retry-After is ignored", backoff: 2 * time.Second, retryAfter: "1", min: time.Second, max: 2 * time.Second},
+		{name: "a longer Retry-After is honored", backoff: 100 * time.Millisecond, retryAfter: "1", min: time.Second, max: time.Second},
+		{name: "Retry-After is capped by MaxBackoff", backoff: 100 * time.Millisecond, retryAfter: "60", min: 5 * time.Second, max: 5 * time.Second},
+		{name: "an HTTP date Retry-After is ignored", backoff: 100 * time.Millisecond, retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT", min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(Config{MaxBackoff: 5 * time.Second})
+			resp := &Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			for i := 0; i < 100; i++ {
+				if d := c.delay(tt.backoff, resp); d < tt.min || d > tt.max {
+					t.Fatalf("expected a delay between %s and %s, got %s", tt.min, tt.max, d)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerOpensAfterFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		closed   bool
+		wantOpen bool
+	}{
+		{name: "5xx", status: 500, wantOpen: true},
+		{name: "transport errors", closed: true, wantOpen: true},
+		{name: "4xx are answers", status: 404, wantOpen: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			cfg.Breaker = BreakerConfig{FailureThreshold: 3, Cooldown: time.Minute}
+			c, _ := newTestClient(cfg)
+			srv, hits := statusServer(t, tt.status)
+			if tt.closed {
+				srv.Close()
+			}
+
+			for i := 0; i < 3; i++ {
+				if _, err := do(t, context.Background(), c, http.MethodGet, srv.URL); errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("expected the circuit to be closed before %d failures", cfg.Breaker.FailureThreshold)
+				}
+			}
+			_, err := do(t, context.Background(), c, http.MethodGet, srv.URL)
+			if got := errors.Is(err, ErrCircuitOpen); got != tt.wantOpen {
+				t.Fatalf("expected the circuit to be open: %t, got %v", tt.wantOpen, err)
+			}
+			if tt.wantOpen && !tt.closed && atomic.LoadInt32(hits) != 3 {
+				t.Errorf("expected the open circuit to leave the dependency alone, got %d requests", atomic.LoadInt32(hits))
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name        string
+		probeStatus int
+		wantState   string
+	}{
+		{name: "a good probe closes the circuit", probeStatus: 200, wantState: stateClosed},
+		{name: "a failed probe opens it again", probeStatus: 503, wantState: stateOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			cfg.Breaker = BreakerConfig{FailureThreshold: 1, Cooldown: 50 * time.Millisecond}
+			c, _ := newTestClient(cfg)
+
+			probing := make(chan struct{})
+			release := make(chan struct{})
+			var hits int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch atomic.AddInt32(&hits, 1) {
+				case 1:
+					w.WriteHeader(500)
+				case 2:
+					close(probing)
+					<-release
+					w.WriteHeader(tt.probeStatus)
+				default:
+					w.WriteHeader(200)
+				}
+			}))
+			defer srv.Close()
+
+			do(t, context.Background(), c, http.MethodPost, srv.URL)
+			if _, err := do(t, context.Background(), c, http.MethodPost, srv.URL); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("expected the circuit to be open, got %v", err)
+			}
+
+			time.Sleep(60 * time.Millisecond)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				do(t, context.Background(), c, http.MethodPost, srv.URL)
+			}()
+			<-probing
+			// a single probe at a time
+			if _, err := do(t, context.Background(), c, http.MethodPost, srv.URL); !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("expected the requests to wait for the probe, got %v", err)
+			}
+			close(release)
+			wg.Wait()
+
+			c.breaker.mu.Lock()
+			state := c.breaker.state
+			c.breaker.mu.Unlock()
+			if state != tt.wantState {
+				t.Errorf("expected the circuit to be %s, got %s", tt.wantState, state)
+			}
+			if got := atomic.LoadInt32(&hits); got != 2 {
+				t.Errorf("expected the failure and the probe only, got %d requests", got)
+			}
+		})
+	}
+}
+
+func TestCanceledCallerIsNotAFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		halfOpen bool
+		// the failure opening the circuit of the half-open case is left as is
+		wantFailures int
+	}{
+		{name: "closed"},
+		{name: "half-open, another probe can go", halfOpen: true, wantFailures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			cfg.Breaker = BreakerConfig{FailureThreshold: 1, Cooldown: time.Millisecond}
+			c, _ := newTestClient(cfg)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("slow") != "" {
+					<-r.Context().Done()
+					return
+				}
+				w.WriteHeader(200)
+			}))
+			defer srv.Close()
+			if tt.halfOpen {
+				c.breaker.failure(context.Background())
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if _, err := do(t, ctx, c, http.MethodGet, srv.URL+"?slow=1"); err == nil {
+				t.Fatal("expected the error of the canceled request")
+			}
+			c.breaker.mu.Lock()
+			failures, probing := c.breaker.failures, c.breaker.probing
+			c.breaker.mu.Unlock()
+			if failures != tt.wantFailures || probing {
+				t.Errorf("expected the cancel not to be recorded as a failure and to free the probe, got %d failures, probing %t", failures, probing)
+			}
+
+			if _, err := do(t, context.Background(), c, http.MethodGet, srv.URL); err != nil {
+				t.Fatalf("expected the next request to go through, got %v", err)
+			}
+			if c.breaker.state != stateClosed {
+				t.Errorf("expected the circuit to be closed, got %s", c.breaker.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package httpclient
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HedgeConfig tells when a second (hedged) request is sent to race a slow one: after the
+// given percentile of the latency of the dependency. The first good answer wins, the other
+// request is canceled.
+type HedgeConfig struct {
+	// Percentile of the latency after which the hedged request is sent (e.g. 95 sends it for
+	// the slowest 5% of the requests), 0 disables the hedging
+	Percentile float64
+	// MinDelay is the shortest wait before hedging, so a fast dependency is not called twice
+	// for a few microseconds of jitter
+	MinDelay time.Duration
+}
+
+// DefaultHedgeConfig doesn't hedge
+var DefaultHedgeConfig = HedgeConfig{
+	Percentile: 0,
+	MinDelay:   10 * time.Millisecond,
+}
+
+const (
+	// latencyWindow is the number of latencies the percentile is computed over
+	latencyWindow = 200
+	// hedgeMinSamples is the number of latencies needed before hedging, the percentile
+	// of a handful of requests means nothing
+	hedgeMinSamples = 20
+)
+
+// The attributes of the hedged requests
+const (
+	hedgeKey       = attribute.Key("http.hedge")
+	hedgeWinnerKey = attribute.Key("http.hedge.winner")
+	hedgeDelayKey  = attribute.Key("http.hedge.delay_ms")
+)
+
+// result is the outcome of an attempt. span is the span of the attempt, left running when
+// the attempt is hedged so the winner can be marked on it.
+type result struct {
+	resp *Response
+	err  error
+	span trace.Span
+}
+
+// good tells whether the outcome of a request is the final answer
+func (r result) good() bool {
+	return r.err == nil && !retryable(r.resp, nil)
+}
+
+// end marks whether the result is the one returned by the hedged attempt, and ends its span
+func (r result) end(winner bool) {
+	r.span.SetAttributes(hedgeWinnerKey.Bool(winner))
+	r.span.End()
+}
+
+// attemptDone is called by the attempts of hedged between their end and the sending of
+// their result, the tests delay the results there
+var attemptDone = func(hedge bool) {}
+
+// hedged sends req, and a second time if the first one is still waiting after the hedge
+// delay. The first good answer is returned and the other request canceled. Without enough
+// latencies to compute the delay, it's a plain attempt.
+func (c *Client) hedged(req *http.Request, attempt int) (*Response, error) {
+	delay, ok := c.hedgeDelay()
+	if !ok {
+		res := c.attempt(req, attempt, nil)
+		return res.resp, res.err
+	}
+
+	// the loser is canceled when we return
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	// buffered, so the loser doesn't block once we're gone
+	results := make(chan result, 2)
+	send := func(hedge bool) {
+		go func() {
+			res := c.attempt(req, attempt, &hedge)
+			attemptDone(hedge)
+			results <- res
+		}()
+	}
+
+	send(false)
+	inFlight := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedging := timer.C
+	for {
+		select {
+		case <-hedging:
+			trace.SpanFromContext(ctx).AddEvent("hedging", trace.WithAttributes(
+				peerServiceKey.String(c.name),
+				attemptKey.Int(attempt),
+				hedgeDelayKey.Int64(delay.Milliseconds()),
+			))
+			send(true)
+			inFlight++
+			hedging = nil
+		case res := <-results:
+			inFlight--
+			// a failed request waits for the other one, if any
+			if !res.good() && inFlight > 0 {
+				res.end(false)
+				continue
+			}
+			// the result returned is the winner, decided here rather than by the attempts
+			// so the span marked is the one of the response
+			res.end(true)
+			if inFlight > 0 {
+				go func() {
+					(<-results).end(false)
+				}()
+			}
+			return res.resp, res.err
+		}
+	}
+}
+
+// hedgeDelay is the wait before sending the hedged request, false if it's not hedged
+func (c *Client) hedgeDelay() (time.Duration, bool) {
+	if c.cfg.Hedge.Percentile <= 0 {
+		return 0, false
+	}
+	c.mu.Lock()
+	latencies := append([]time.Duration(nil), c.latencies...)
+	c.mu.Unlock()
+	if len(latencies) < hedgeMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	i := int(math.Ceil(c.cfg.Hedge.Percentile/100*float64(len(latencies)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	delay := latencies[i]
+	if delay < c.cfg.Hedge.MinDelay {
+		delay = c.cfg.Hedge.MinDelay
+	}
+	return delay, true
+}
+
+// recordLatency keeps the latency of an answered request for the percentile, in a ring
+func (c *Client) recordLatency(d time.Duration) {
+	if c.cfg.Hedge.Percentile <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.latencies) < latencyWindow {
+		c.latencies = append(c.latencies, d)
+		return
+	}
+	c.latencies[c.next] = d
+	c.next = (c.next + 1) % latencyWindow
+}
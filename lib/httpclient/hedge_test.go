@@ -0,0 +1,268 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// newHedgingClient returns a Client hedging after the 50th percentile of a latency of 20ms
+func newHedgingClient() (*Client, *tracetest.InMemoryExporter) {
+	cfg := testConfig
+	cfg.Hedge = HedgeConfig{Percentile: 50, MinDelay: time.Millisecond}
+	c, exporter := newTestClient(cfg)
+	for i := 0; i < hedgeMinSamples; i++ {
+		c.recordLatency(20 * time.Millisecond)
+	}
+	return c, exporter
+}
+
+// attemptSpans waits for n attempt spans and returns them
+func attemptSpans(t *testing.T, exporter *tracetest.InMemoryExporter, n int) []*sdktrace.SpanSnapshot {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var spans []*sdktrace.SpanSnapshot
+		for _, span := range exporter.GetSpans() {
+			if span.Name == "dependency-attempt" {
+				spans = append(spans, span)
+			}
+		}
+		if len(spans) >= n || time.Now().After(deadline) {
+			if len(spans) != n {
+				t.Fatalf("expected %d attempt spans, got %d", n, len(spans))
+			}
+			return spans
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// spanAttribute returns the value of key on span
+func spanAttribute(span *sdktrace.SpanSnapshot, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestHedgeDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentile float64
+		minDelay   time.Duration
+		samples    int
+		want       time.Duration
+		wantHedge  bool
+	}{
+		{name: "disabled", percentile: 0, samples: 100},
+		{name: "too few samples", percentile: 95, samples: hedgeMinSamples - 1},
+		{name: "95th percentile", percentile: 95, samples: 100, want: 95 * time.Millisecond, wantHedge: true},
+		{name: "50th percentile", percentile: 50, samples: 100, want: 50 * time.Millisecond, wantHedge: true},
+		{name: "100th percentile", percentile: 100, samples: 100, want: 100 * time.Millisecond, wantHedge: true},
+		{name: "min delay", percentile: 50, minDelay: 80 * time.Millisecond, samples: 100, want: 80 * time.Millisecond, wantHedge: true},
+		{name: "window of the last latencies", percentile: 50, samples: latencyWindow + 100, want: 200 * time.Millisecond, wantHedge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(Config{Hedge: HedgeConfig{Percentile: tt.percentile, MinDelay: tt.minDelay}})
+			// 1ms, 2ms, ...
+			for i := 1; i <= tt.samples; i++ {
+				c.recordLatency(time.Duration(i) * time.Millisecond)
+			}
+			delay, hedge := c.hedgeDelay()
+			if hedge != tt.wantHedge || delay != tt.want {
+				t.Errorf("expected %s (hedge %t), got %s (hedge %t)", tt.want, tt.wantHedge, delay, hedge)
+			}
+		})
+	}
+}
+
+func TestHedgeWinsOverASlowRequest(t *testing.T) {
+	c, exporter := newHedgingClient()
+	var hits int32
+	loserCanceled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(loserCanceled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	ctx, caller := c.tracer.Start(context.Background(), "caller")
+	start := time.Now()
+	resp, err := do(t, ctx, c, http.MethodGet, srv.URL)
+	elapsed := time.Since(start)
+	caller.End()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected the answer of the hedged request, got %d", resp.StatusCode)
+	}
+	if elapsed < 20*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected the hedged request to be sent after the 20ms percentile, answered in %s", elapsed)
+	}
+
+	select {
+	case <-loserCanceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the slow request to be canceled")
+	}
+	spans := attemptSpans(t, exporter, 2)
+	for _, span := range spans {
+		hedge, _ := spanAttribute(span, hedgeKey)
+		winner, ok := spanAttribute(span, hedgeWinnerKey)
+		if !ok {
+			t.Errorf("expected http.hedge.winner on the attempt (hedge %t)", hedge.AsBool())
+		}
+		if winner.AsBool() != hedge.AsBool() {
+			t.Errorf("expected the hedged attempt to be the winner, got hedge %t winner %t", hedge.AsBool(), winner.AsBool())
+		}
+		if span.Parent.SpanID() != caller.SpanContext().SpanID() {
+			t.Error("expected the attempts to be children of the caller")
+		}
+	}
+
+	c.breaker.mu.Lock()
+	failures := c.breaker.failures
+	c.breaker.mu.Unlock()
+	if failures != 0 {
+		t.Errorf("expected the canceled loser not to be charged to the breaker, got %d failures", failures)
+	}
+
+	var hedging bool
+	for _, span := range exporter.GetSpans() {
+		if span.Name != "caller" {
+			continue
+		}
+		for _, event := range span.MessageEvents {
+			if event.Name == "hedging" {
+				hedging = true
+			}
+		}
+	}
+	if !hedging {
+		t.Error("expected a hedging event on the span of the caller")
+	}
+}
+
+func TestNoHedgeForAFastRequest(t *testing.T) {
+	c, exporter := newHedgingClient()
+	srv, hits := statusServer(t, 200)
+
+	if _, err := do(t, context.Background(), c, http.MethodGet, srv.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// leave the time to a hedged request to show up, there must be none
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("expected a single request, got %d", got)
+	}
+	spans := attemptSpans(t, exporter, 1)
+	if winner, _ := spanAttribute(spans[0], hedgeWinnerKey); !winner.AsBool() {
+		t.Error("expected the single request to be the winner")
+	}
+}
+
+func TestFailedRequestWaitsForTheHedge(t *testing.T) {
+	c, exporter := newHedgingClient()
+	c.cfg.MaxRetries = 0
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			// slow and failing, the hedged request is already out when it answers
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(503)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	resp, err := do(t, context.Background(), c, http.MethodGet, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected the good answer of the hedged request, got %d", resp.StatusCode)
+	}
+	for _, span := range attemptSpans(t, exporter, 2) {
+		hedge, _ := spanAttribute(span, hedgeKey)
+		if winner, _ := spanAttribute(span, hedgeWinnerKey); winner.AsBool() != hedge.AsBool() {
+			t.Errorf("expected only the hedged attempt to win, got hedge %t winner %t", hedge.AsBool(), winner.AsBool())
+		}
+	}
+}
+
+func TestWinnerIsTheAnswerReturned(t *testing.T) {
+	c, exporter := newHedgingClient()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			time.Sleep(30 * time.Millisecond)
+			w.WriteHeader(200)
+			return
+		}
+		// the hedged request answers after the first one...
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(203)
+	}))
+	defer srv.Close()
+	// ...but its result is received first
+	attemptDone = func(hedge bool) {
+		if !hedge {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	defer func() { attemptDone = func(bool) {} }()
+
+	resp, err := do(t, context.Background(), c, http.MethodGet, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 203 {
+		t.Fatalf("expected the answer of the hedged request, received first, got %d", resp.StatusCode)
+	}
+	for _, span := range attemptSpans(t, exporter, 2) {
+		winner, _ := spanAttribute(span, hedgeWinnerKey)
+		status, _ := spanAttribute(span, semconv.HTTPStatusCodeKey)
+		if winner.AsBool() != (status.AsInt64() == 203) {
+			t.Errorf("expected the winner to be the answer returned, got winner %t for %d", winner.AsBool(), status.AsInt64())
+		}
+	}
+}
+
+func TestNotIdempotentIsNotHedged(t *testing.T) {
+	c, _ := newHedgingClient()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(201)
+	}))
+	defer srv.Close()
+
+	if _, err := do(t, context.Background(), c, http.MethodPost, srv.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("expected the POST to be sent once, got %d requests", got)
+	}
+}
@@ -1,8 +1,55 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// The sizes of the columns of the people table (db/database.sql)
+const (
+	MaxNameLength        = 100
+	MaxTitleLength       = 10
+	MaxDescriptionLength = 100
+)
+
 // Person represents a person.
 type Person struct {
 	Name        string
 	Title       string
 	Description string
 }
+
+// Validate checks the person fits in the people table: the name is required and, like the
+// title and the description, must not be longer than its column.
+// The name can't contain a slash since it is used in the urls (/people/{name}).
+func (p Person) Validate() error {
+	var problems []string
+	switch {
+	case strings.TrimSpace(p.Name) == "":
+		problems = append(problems, "name is required")
+	case utf8.RuneCountInString(p.Name) > MaxNameLength:
+		problems = append(problems, fmt.Sprintf("name is longer than %d characters", MaxNameLength))
+	case strings.Contains(p.Name, "/"):
+		problems = append(problems, "name must not contain a slash")
+	}
+	if utf8.RuneCountInString(p.Title) > MaxTitleLength {
+		problems = append(problems, fmt.Sprintf("title is longer than %d characters", MaxTitleLength))
+	}
+	if utf8.RuneCountInString(p.Description) > MaxDescriptionLength {
+		problems = append(problems, fmt.Sprintf("description is longer than %d characters", MaxDescriptionLength))
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid person: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// PeopleBatch is the answer of the batch lookup of queryyer (/getPeople).
+type PeopleBatch struct {
+	// Found are the known people, in the order they were asked for
+	Found []Person
+	// Missing are the names of the unknown people
+	Missing []string
+}
@@ -0,0 +1,174 @@
+package otelsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// otelConn wraps a driver.Conn, the optional interfaces which are not implemented by the
+// parent are answered the way database/sql would do without them.
+type otelConn struct {
+	parent driver.Conn
+	driver *otelDriver
+}
+
+var (
+	_ driver.Conn               = (*otelConn)(nil)
+	_ driver.ConnBeginTx        = (*otelConn)(nil)
+	_ driver.ConnPrepareContext = (*otelConn)(nil)
+	_ driver.ExecerContext      = (*otelConn)(nil)
+	_ driver.QueryerContext     = (*otelConn)(nil)
+	_ driver.Pinger             = (*otelConn)(nil)
+	_ driver.SessionResetter    = (*otelConn)(nil)
+	_ driver.Validator          = (*otelConn)(nil)
+	_ driver.NamedValueChecker  = (*otelConn)(nil)
+)
+
+// Prepare implements driver.Conn.
+func (c *otelConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// Close implements driver.Conn.
+func (c *otelConn) Close() error {
+	return c.parent.Close()
+}
+
+// Begin implements driver.Conn.
+//
+// Deprecated: Drivers should implement ConnBeginTx instead (or additionally).
+func (c *otelConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx implements driver.ConnBeginTx.
+func (c *otelConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var tx driver.Tx
+	var err error
+	if cbt, ok := c.parent.(driver.ConnBeginTx); ok {
+		tx, err = cbt.BeginTx(ctx, opts)
+	} else {
+		//nolint:staticcheck // fallback for the drivers without ConnBeginTx
+		tx, err = c.parent.Begin()
+	}
+	c.driver.record(ctx, "sql.begin", "", start, err, attribute.Bool("db.transaction.read_only", opts.ReadOnly))
+	if err != nil {
+		return nil, err
+	}
+	return &otelTx{parent: tx, ctx: ctx, driver: c.driver}, nil
+}
+
+// PrepareContext implements driver.ConnPrepareContext.
+func (c *otelConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	var stmt driver.Stmt
+	var err error
+	if cpc, ok := c.parent.(driver.ConnPrepareContext); ok {
+		stmt, err = cpc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.parent.Prepare(query)
+	}
+	c.driver.record(ctx, "sql.prepare", query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &otelStmt{parent: stmt, query: query, driver: c.driver}, nil
+}
+
+// ExecContext implements driver.ExecerContext.
+func (c *otelConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.parent.(driver.ExecerContext)
+	if !ok {
+		// database/sql prepares the statement then
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := execer.ExecContext(ctx, query, args)
+	c.driver.record(ctx, "sql.exec", query, start, err)
+	return res, err
+}
+
+// QueryContext implements driver.QueryerContext.
+func (c *otelConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.parent.(driver.QueryerContext)
+	if !ok {
+		// database/sql prepares the statement then
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.driver.record(ctx, "sql.query", query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(ctx, rows, query, c.driver), nil
+}
+
+// Ping implements driver.Pinger.
+func (c *otelConn) Ping(ctx context.Context) error {
+	pinger, ok := c.parent.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	err := pinger.Ping(ctx)
+	c.driver.record(ctx, "sql.ping", "", start, err)
+	return err
+}
+
+// ResetSession implements driver.SessionResetter.
+func (c *otelConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.parent.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator.
+func (c *otelConn) IsValid() bool {
+	if validator, ok := c.parent.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+func (c *otelConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.parent.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	// database/sql uses its default converter then
+	return driver.ErrSkip
+}
+
+// otelTx wraps a driver.Tx, ctx is the one the transaction began with
+type otelTx struct {
+	parent driver.Tx
+	ctx    context.Context
+	driver *otelDriver
+}
+
+// Commit implements driver.Tx.
+func (t *otelTx) Commit() error {
+	start := time.Now()
+	err := t.parent.Commit()
+	t.driver.record(t.ctx, "sql.commit", "", start, err)
+	return err
+}
+
+// Rollback implements driver.Tx.
+func (t *otelTx) Rollback() error {
+	start := time.Now()
+	err := t.parent.Rollback()
+	// database/sql rolls back the transactions whose context is done, that is not an error of the query
+	if errors.Is(err, driver.ErrBadConn) {
+		err = nil
+	}
+	t.driver.record(t.ctx, "sql.rollback", "", start, err)
+	return err
+}
@@ -0,0 +1,169 @@
+// Package otelsql wraps a database/sql driver so every query, exec, prepare and
+// transaction gets its own span, with the semantic-convention attributes (db.system,
+// db.statement, db.name, net.peer.name, ...).
+package otelsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "medium-opentelemetry-poc/lib/otelsql"
+
+// Open opens a database like sql.Open, but the driver registered as driverName is wrapped
+// so every call to the database is traced. attrs are added to every span, they should describe
+// the database (e.g. semconv.DBSystemMySQL, semconv.DBNameKey, semconv.NetPeerNameKey).
+func Open(driverName, dsn string, attrs ...attribute.KeyValue) (*sql.DB, error) {
+	// database/sql doesn't give access to the registered drivers, except through a DB
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	parent := db.Driver()
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+
+	d := &otelDriver{
+		parent: parent,
+		tracer: otel.Tracer(instrumentationName),
+		attrs:  attrs,
+	}
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// otelDriver wraps the driver.Driver of the database
+type otelDriver struct {
+	parent driver.Driver
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+// Open implements driver.Driver.
+func (d *otelDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.parent.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &otelConn{parent: conn, driver: d}, nil
+}
+
+// OpenConnector implements driver.DriverContext.
+func (d *otelDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.parent.(driver.DriverContext); ok {
+		parent, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &otelConnector{parent: parent, driver: d}, nil
+	}
+	return &otelConnector{parent: dsnConnector{dsn: name, driver: d.parent}, driver: d}, nil
+}
+
+// record creates the span of a call to the database which started at start and is done now.
+// The span is created after the call, so we don't record the calls the driver skipped
+// (driver.ErrSkip, database/sql does it again in another way, e.g. prepare then query).
+func (d *otelDriver) record(ctx context.Context, name, query string, start time.Time, err error, attrs ...attribute.KeyValue) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	_, span := d.start(ctx, name, query, start)
+	span.SetAttributes(attrs...)
+	endSpan(span, err)
+}
+
+type withoutTracingKey struct{}
+
+// WithoutTracing returns a copy of ctx whose calls to the database are not traced,
+// e.g. for the health checks which would drown the real traces.
+func WithoutTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutTracingKey{}, true)
+}
+
+// start starts the span of a call to the database (started at start)
+func (d *otelDriver) start(ctx context.Context, name, query string, start time.Time) (context.Context, trace.Span) {
+	if ctx.Value(withoutTracingKey{}) != nil {
+		// the span of the background context is a no-op one
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	attrs := append([]attribute.KeyValue{}, d.attrs...)
+	if query != "" {
+		attrs = append(attrs,
+			semconv.DBStatementKey.String(query),
+			semconv.DBOperationKey.String(operation(query)),
+		)
+	}
+	return d.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan records err, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// operation is the first word of the query (select, insert...)
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// otelConnector wraps the driver.Connector of the database
+type otelConnector struct {
+	parent driver.Connector
+	driver *otelDriver
+}
+
+// Connect implements driver.Connector.
+func (c *otelConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	start := time.Now()
+	conn, err := c.parent.Connect(ctx)
+	c.driver.record(ctx, "sql.connect", "", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &otelConn{parent: conn, driver: c.driver}, nil
+}
+
+// Driver implements driver.Connector.
+func (c *otelConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dsnConnector is the connector of the drivers which don't implement driver.DriverContext
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,398 @@
+package otelsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errQuery is returned by the fake driver for the queries containing "fail"
+var errQuery = errors.New("you have an error in your SQL syntax")
+
+// fakeDriver answers every query with the rows of people, its connections implement the
+// context interfaces (QueryerContext, ExecerContext...) only if withContext. It keeps the
+// time of the last call to the database, to check the spans start before it.
+type fakeDriver struct {
+	withContext bool
+
+	mu       sync.Mutex
+	lastCall time.Time
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	conn := &fakeConn{driver: d}
+	if d.withContext {
+		return &fakeContextConn{conn}, nil
+	}
+	return conn, nil
+}
+
+func (d *fakeDriver) call(query string) error {
+	d.mu.Lock()
+	d.lastCall = time.Now()
+	d.mu.Unlock()
+	if strings.Contains(query, "fail") {
+		return errQuery
+	}
+	return nil
+}
+
+// fakeConn only implements driver.Conn, database/sql prepares every query then
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if err := c.driver.call(query); err != nil {
+		return nil, err
+	}
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+// fakeContextConn is a fakeConn which runs the queries without preparing them
+type fakeContextConn struct {
+	*fakeConn
+}
+
+func (c *fakeContextConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.driver.call(query); err != nil {
+		return nil, err
+	}
+	return &fakeRows{names: []string{"Margo", "Farhad"}}, nil
+}
+
+func (c *fakeContextConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.driver.call(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeContextConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if err := s.conn.driver.call(s.query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if err := s.conn.driver.call(s.query); err != nil {
+		return nil, err
+	}
+	return &fakeRows{names: []string{"Margo", "Farhad"}}, nil
+}
+
+type fakeRows struct {
+	names []string
+}
+
+func (r *fakeRows) Columns() []string { return []string{"name"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.names) == 0 {
+		return io.EOF
+	}
+	dest[0], r.names = r.names[0], r.names[1:]
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// openTestDB opens a traced database of parent, whose spans go to the returned exporter
+func openTestDB(t *testing.T, parent driver.Driver) (*sql.DB, trace.Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+	d := &otelDriver{parent: parent, tracer: tracer, attrs: []attribute.KeyValue{semconv.DBSystemMySQL}}
+	connector, err := d.OpenConnector("people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() { db.Close() })
+	return db, tracer, exporter
+}
+
+// dbSpans returns the spans of the calls to the database, the connections apart
+func dbSpans(exporter *tracetest.InMemoryExporter) []*sdktrace.SpanSnapshot {
+	var spans []*sdktrace.SpanSnapshot
+	for _, span := range exporter.GetSpans() {
+		if strings.HasPrefix(span.Name, "sql.") && span.Name != "sql.connect" {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func spanNames(spans []*sdktrace.SpanSnapshot) string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func attributeValue(span *sdktrace.SpanSnapshot, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSpans(t *testing.T) {
+	const query = "SELECT name FROM people"
+	const insert = "INSERT INTO people VALUES (?, ?, ?)"
+	readAll := func(t *testing.T, rows *sql.Rows) {
+		for rows.Next() {
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// withContext is the kind of connection of the driver, the queries are prepared otherwise
+		withContext bool
+		run         func(t *testing.T, ctx context.Context, db *sql.DB)
+		// want are the names of the spans, in the order they ended
+		want string
+		// statement is the db.statement of the spans which aren't part of a transaction
+		statement string
+	}{
+		{
+			name:        "query",
+			withContext: true,
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				rows, err := db.QueryContext(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				readAll(t, rows)
+			},
+			want:      "sql.query,sql.rows",
+			statement: query,
+		},
+		{
+			name: "query prepared by database/sql (ErrSkip)",
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				rows, err := db.QueryContext(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				readAll(t, rows)
+			},
+			want:      "sql.prepare,sql.query,sql.rows",
+			statement: query,
+		},
+		{
+			name:        "exec",
+			withContext: true,
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				if _, err := db.ExecContext(ctx, insert, "Margo", "Ms.", "Privet!"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:      "sql.exec",
+			statement: insert,
+		},
+		{
+			name: "exec prepared by database/sql (ErrSkip)",
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				if _, err := db.ExecContext(ctx, insert, "Margo", "Ms.", "Privet!"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:      "sql.prepare,sql.exec",
+			statement: insert,
+		},
+		{
+			name:        "prepare",
+			withContext: true,
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				stmt, err := db.PrepareContext(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer stmt.Close()
+				rows, err := stmt.QueryContext(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				readAll(t, rows)
+			},
+			want:      "sql.prepare,sql.query,sql.rows",
+			statement: query,
+		},
+		{
+			name:        "transaction",
+			withContext: true,
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				tx, err := db.BeginTx(ctx, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tx.ExecContext(ctx, insert, "Margo", "Ms.", "Privet!"); err != nil {
+					t.Fatal(err)
+				}
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "sql.begin,sql.exec,sql.commit",
+		},
+		{
+			name: "rolled back transaction",
+			run: func(t *testing.T, ctx context.Context, db *sql.DB) {
+				tx, err := db.BeginTx(ctx, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := tx.Rollback(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "sql.begin,sql.rollback",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := &fakeDriver{withContext: tt.withContext}
+			db, tracer, exporter := openTestDB(t, parent)
+			ctx, caller := tracer.Start(context.Background(), "caller")
+			tt.run(t, ctx, db)
+			caller.End()
+
+			spans := dbSpans(exporter)
+			if got := spanNames(spans); got != tt.want {
+				t.Fatalf("expected the spans %s, got %s", tt.want, got)
+			}
+			for _, span := range spans {
+				if span.Parent.SpanID() != caller.SpanContext().SpanID() {
+					t.Errorf("expected %s to be a child of the caller", span.Name)
+				}
+				if span.SpanKind != trace.SpanKindClient {
+					t.Errorf("expected %s to be a client span, got %v", span.Name, span.SpanKind)
+				}
+				if got := attributeValue(span, semconv.DBSystemKey); got != "mysql" {
+					t.Errorf("expected db.system=mysql on %s, got %q", span.Name, got)
+				}
+				if span.StatusCode != codes.Unset {
+					t.Errorf("expected %s not to fail, got %v", span.Name, span.StatusCode)
+				}
+				if tt.statement != "" {
+					if got := attributeValue(span, semconv.DBStatementKey); got != tt.statement {
+						t.Errorf("expected db.statement=%q on %s, got %q", tt.statement, span.Name, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSpansAreBackdated(t *testing.T) {
+	parent := &fakeDriver{withContext: true}
+	db, _, exporter := openTestDB(t, parent)
+	rows, err := db.QueryContext(context.Background(), "SELECT name FROM people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	for rows.Next() {
+	}
+	rows.Close()
+
+	spans := dbSpans(exporter)
+	if len(spans) != 2 {
+		t.Fatalf("expected the query and rows spans, got %s", spanNames(spans))
+	}
+	query, read := spans[0], spans[1]
+	// the span of the query is created once the driver answered, started at the call
+	if !query.StartTime.Before(parent.lastCall) {
+		t.Errorf("expected the query span to start before the call to the driver (%s), got %s", parent.lastCall, query.StartTime)
+	}
+	if read.EndTime.Sub(read.StartTime) < 10*time.Millisecond {
+		t.Errorf("expected the rows span to last until the rows are closed, lasted %s", read.EndTime.Sub(read.StartTime))
+	}
+	if got := attributeValue(read, rowsCountKey); got != "2" {
+		t.Errorf("expected db.rows=2, got %s", got)
+	}
+}
+
+func TestFailedCalls(t *testing.T) {
+	for _, withContext := range []bool{true, false} {
+		parent := &fakeDriver{withContext: withContext}
+		db, _, exporter := openTestDB(t, parent)
+		if _, err := db.QueryContext(context.Background(), "SELECT fail"); !errors.Is(err, errQuery) {
+			t.Fatalf("expected the error of the driver, got %v", err)
+		}
+		if _, err := db.ExecContext(context.Background(), "DELETE fail"); !errors.Is(err, errQuery) {
+			t.Fatalf("expected the error of the driver, got %v", err)
+		}
+
+		spans := dbSpans(exporter)
+		// without context, the failed prepare is the only call to the driver
+		want := "sql.query,sql.exec"
+		if !withContext {
+			want = "sql.prepare,sql.prepare"
+		}
+		if got := spanNames(spans); got != want {
+			t.Fatalf("expected the spans %s (context %t), got %s", want, withContext, got)
+		}
+		for _, span := range spans {
+			if span.StatusCode != codes.Error || span.StatusMessage != errQuery.Error() {
+				t.Errorf("expected %s to fail with %q, got %v %q", span.Name, errQuery, span.StatusCode, span.StatusMessage)
+			}
+			if len(span.MessageEvents) != 1 || span.MessageEvents[0].Name != "exception" {
+				t.Errorf("expected the error to be recorded on %s", span.Name)
+			}
+		}
+	}
+}
+
+func TestWithoutTracing(t *testing.T) {
+	db, _, exporter := openTestDB(t, &fakeDriver{withContext: true})
+	if err := db.PingContext(WithoutTracing(context.Background())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(WithoutTracing(context.Background()), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if spans := dbSpans(exporter); len(spans) != 0 {
+		t.Errorf("expected no span, got %s", spanNames(spans))
+	}
+}
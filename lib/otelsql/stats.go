@@ -0,0 +1,94 @@
+package otelsql
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/unit"
+)
+
+// The metrics of the connection pool published by RecordStats (sql.DBStats)
+const (
+	maxOpenMetric           = "db.client.connections.max"
+	openMetric              = "db.client.connections.open"
+	inUseMetric             = "db.client.connections.in_use"
+	idleMetric              = "db.client.connections.idle"
+	waitCountMetric         = "db.client.connections.wait_count"
+	waitDurationMetric      = "db.client.connections.wait_duration"
+	maxIdleClosedMetric     = "db.client.connections.max_idle_closed"
+	maxIdleTimeClosedMetric = "db.client.connections.max_idle_time_closed"
+	maxLifetimeClosedMetric = "db.client.connections.max_lifetime_closed"
+)
+
+// RecordStats publishes the sql.DBStats of the connection pool of db as observable metrics,
+// read every time the metrics are collected. attrs are added as labels, they should tell the
+// pools apart (e.g. semconv.DBSystemMySQL, semconv.DBNameKey).
+// When wait_count and wait_duration grow, the queries are waiting for a free connection:
+// the pool is exhausted and MaxOpenConns is too low for the load.
+func RecordStats(db *sql.DB, attrs ...attribute.KeyValue) error {
+	meter := global.Meter(instrumentationName)
+
+	var (
+		err                                  error
+		maxOpen, open, inUse, idle           metric.Int64UpDownSumObserver
+		waitCount, maxIdleClosed             metric.Int64SumObserver
+		maxIdleTimeClosed, maxLifetimeClosed metric.Int64SumObserver
+		waitDuration                         metric.Float64SumObserver
+	)
+	batch := meter.NewBatchObserver(func(_ context.Context, result metric.BatchObserverResult) {
+		stats := db.Stats()
+		result.Observe(attrs,
+			maxOpen.Observation(int64(stats.MaxOpenConnections)),
+			open.Observation(int64(stats.OpenConnections)),
+			inUse.Observation(int64(stats.InUse)),
+			idle.Observation(int64(stats.Idle)),
+			waitCount.Observation(stats.WaitCount),
+			waitDuration.Observation(float64(stats.WaitDuration.Microseconds())/1000),
+			maxIdleClosed.Observation(stats.MaxIdleClosed),
+			maxIdleTimeClosed.Observation(stats.MaxIdleTimeClosed),
+			maxLifetimeClosed.Observation(stats.MaxLifetimeClosed),
+		)
+	})
+
+	if maxOpen, err = batch.NewInt64UpDownSumObserver(maxOpenMetric,
+		metric.WithDescription("Maximum number of open connections of the pool (0 is unlimited)")); err != nil {
+		return err
+	}
+	if open, err = batch.NewInt64UpDownSumObserver(openMetric,
+		metric.WithDescription("Number of established connections, both in use and idle")); err != nil {
+		return err
+	}
+	if inUse, err = batch.NewInt64UpDownSumObserver(inUseMetric,
+		metric.WithDescription("Number of connections currently in use")); err != nil {
+		return err
+	}
+	if idle, err = batch.NewInt64UpDownSumObserver(idleMetric,
+		metric.WithDescription("Number of idle connections")); err != nil {
+		return err
+	}
+	if waitCount, err = batch.NewInt64SumObserver(waitCountMetric,
+		metric.WithDescription("Total number of connections waited for")); err != nil {
+		return err
+	}
+	if waitDuration, err = batch.NewFloat64SumObserver(waitDurationMetric,
+		metric.WithDescription("Total time blocked waiting for a new connection"),
+		metric.WithUnit(unit.Milliseconds)); err != nil {
+		return err
+	}
+	if maxIdleClosed, err = batch.NewInt64SumObserver(maxIdleClosedMetric,
+		metric.WithDescription("Total number of connections closed due to MaxIdleConns")); err != nil {
+		return err
+	}
+	if maxIdleTimeClosed, err = batch.NewInt64SumObserver(maxIdleTimeClosedMetric,
+		metric.WithDescription("Total number of connections closed due to ConnMaxIdleTime")); err != nil {
+		return err
+	}
+	if maxLifetimeClosed, err = batch.NewInt64SumObserver(maxLifetimeClosedMetric,
+		metric.WithDescription("Total number of connections closed due to ConnMaxLifetime")); err != nil {
+		return err
+	}
+	return nil
+}
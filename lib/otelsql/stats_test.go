@@ -0,0 +1,83 @@
+package otelsql
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/global"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// collect reads the metrics of the pool once
+func collect(t *testing.T, cont *controller.Controller) map[string]float64 {
+	if err := cont.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	err := cont.ForEach(export.CumulativeExportKindSelector(), func(record export.Record) error {
+		sum, err := record.Aggregation().(aggregation.Sum).Sum()
+		if err != nil {
+			return err
+		}
+		if db, _ := record.Labels().Value(semconv.DBSystemKey); db.AsString() != "mysql" {
+			t.Errorf("expected the db.system label on %s", record.Descriptor().Name())
+		}
+		values[record.Descriptor().Name()] = sum.CoerceToFloat64(record.Descriptor().NumberKind())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestRecordStats(t *testing.T) {
+	// every call to Collect reads the pool, whatever the time since the last one
+	cont := controller.New(processor.New(simple.NewWithInexpensiveDistribution(), export.CumulativeExportKindSelector()),
+		controller.WithCollectPeriod(0))
+	old := global.GetMeterProvider()
+	global.SetMeterProvider(cont.MeterProvider())
+	t.Cleanup(func() { global.SetMeterProvider(old) })
+
+	db, _, _ := openTestDB(t, &fakeDriver{withContext: true})
+	db.SetMaxOpenConns(5)
+	if err := RecordStats(db, semconv.DBSystemMySQL); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := collect(t, cont)
+	conn.Close()
+	out := collect(t, cont)
+
+	tests := []struct {
+		metric  string
+		in, out float64
+	}{
+		{metric: maxOpenMetric, in: 5, out: 5},
+		{metric: openMetric, in: 1, out: 1},
+		{metric: inUseMetric, in: 1, out: 0},
+		{metric: idleMetric, in: 0, out: 1},
+		{metric: waitCountMetric, in: 0, out: 0},
+		{metric: waitDurationMetric, in: 0, out: 0},
+		{metric: maxIdleClosedMetric, in: 0, out: 0},
+		{metric: maxIdleTimeClosedMetric, in: 0, out: 0},
+		{metric: maxLifetimeClosedMetric, in: 0, out: 0},
+	}
+	for _, tt := range tests {
+		if got, ok := in[tt.metric]; !ok || got != tt.in {
+			t.Errorf("expected %s=%v while the connection is used, got %v", tt.metric, tt.in, got)
+		}
+		if got, ok := out[tt.metric]; !ok || got != tt.out {
+			t.Errorf("expected %s=%v once the connection is released, got %v", tt.metric, tt.out, got)
+		}
+	}
+}
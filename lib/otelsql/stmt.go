@@ -0,0 +1,225 @@
+package otelsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelStmt wraps a prepared driver.Stmt
+type otelStmt struct {
+	parent driver.Stmt
+	query  string
+	driver *otelDriver
+}
+
+var (
+	_ driver.Stmt              = (*otelStmt)(nil)
+	_ driver.StmtExecContext   = (*otelStmt)(nil)
+	_ driver.StmtQueryContext  = (*otelStmt)(nil)
+	_ driver.NamedValueChecker = (*otelStmt)(nil)
+)
+
+// Close implements driver.Stmt.
+func (s *otelStmt) Close() error {
+	return s.parent.Close()
+}
+
+// NumInput implements driver.Stmt.
+func (s *otelStmt) NumInput() int {
+	return s.parent.NumInput()
+}
+
+// Exec implements driver.Stmt.
+//
+// Deprecated: Drivers should implement StmtExecContext instead (or additionally).
+func (s *otelStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+// Query implements driver.Stmt.
+//
+// Deprecated: Drivers should implement StmtQueryContext instead (or additionally).
+func (s *otelStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+// ExecContext implements driver.StmtExecContext.
+func (s *otelStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if sec, ok := s.parent.(driver.StmtExecContext); ok {
+		res, err = sec.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = plainValues(args); err == nil {
+			//nolint:staticcheck // fallback for the drivers without StmtExecContext
+			res, err = s.parent.Exec(values)
+		}
+	}
+	s.driver.record(ctx, "sql.exec", s.query, start, err)
+	return res, err
+}
+
+// QueryContext implements driver.StmtQueryContext.
+func (s *otelStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if sqc, ok := s.parent.(driver.StmtQueryContext); ok {
+		rows, err = sqc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = plainValues(args); err == nil {
+			//nolint:staticcheck // fallback for the drivers without StmtQueryContext
+			rows, err = s.parent.Query(values)
+		}
+	}
+	s.driver.record(ctx, "sql.query", s.query, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(ctx, rows, s.query, s.driver), nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+func (s *otelStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.parent.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// plainValues is what database/sql does for the drivers which don't support named values
+func plainValues(named []driver.NamedValue) ([]driver.Value, error) {
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("otelsql: driver does not support the use of Named Parameters")
+		}
+		args[i] = nv.Value
+	}
+	return args, nil
+}
+
+// rowsCountKey is the number of rows read from the result of a query
+const rowsCountKey = attribute.Key("db.rows")
+
+// otelRows wraps the driver.Rows of a query, its span goes from the end of the query
+// to the close of the rows, so reading the result shows up in the trace as well.
+type otelRows struct {
+	parent driver.Rows
+	span   trace.Span
+	count  int64
+	err    error
+}
+
+// newRows wraps rows, keeping the optional interfaces of the result set implemented by the driver
+// (next result set, column types) since database/sql looks for them.
+func newRows(ctx context.Context, rows driver.Rows, query string, d *otelDriver) driver.Rows {
+	_, span := d.start(ctx, "sql.rows", query, time.Now())
+	r := &otelRows{parent: rows, span: span}
+	if _, ok := rows.(driver.RowsNextResultSet); ok {
+		return &otelRowsNextResultSet{otelRows: r}
+	}
+	return r
+}
+
+// Columns implements driver.Rows.
+func (r *otelRows) Columns() []string {
+	return r.parent.Columns()
+}
+
+// Close implements driver.Rows.
+func (r *otelRows) Close() error {
+	err := r.parent.Close()
+	r.span.SetAttributes(rowsCountKey.Int64(r.count))
+	if r.err == nil {
+		r.err = err
+	}
+	endSpan(r.span, r.err)
+	return err
+}
+
+// Next implements driver.Rows.
+func (r *otelRows) Next(dest []driver.Value) error {
+	err := r.parent.Next(dest)
+	switch {
+	case err == nil:
+		r.count++
+	case !errors.Is(err, io.EOF):
+		r.err = err
+	}
+	return err
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.
+func (r *otelRows) ColumnTypeScanType(index int) reflect.Type {
+	if rc, ok := r.parent.(driver.RowsColumnTypeScanType); ok {
+		return rc.ColumnTypeScanType(index)
+	}
+	// what database/sql uses when the driver doesn't tell
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName.
+func (r *otelRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rc, ok := r.parent.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rc.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength.
+func (r *otelRows) ColumnTypeLength(index int) (int64, bool) {
+	if rc, ok := r.parent.(driver.RowsColumnTypeLength); ok {
+		return rc.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable.
+func (r *otelRows) ColumnTypeNullable(index int) (bool, bool) {
+	if rc, ok := r.parent.(driver.RowsColumnTypeNullable); ok {
+		return rc.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+// ColumnTypePrecisionScale implements driver.RowsColumnTypePrecisionScale.
+func (r *otelRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if rc, ok := r.parent.(driver.RowsColumnTypePrecisionScale); ok {
+		return rc.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+// otelRowsNextResultSet is otelRows of a driver which supports multiple result sets
+type otelRowsNextResultSet struct {
+	*otelRows
+}
+
+// HasNextResultSet implements driver.RowsNextResultSet.
+func (r *otelRowsNextResultSet) HasNextResultSet() bool {
+	return r.parent.(driver.RowsNextResultSet).HasNextResultSet()
+}
+
+// NextResultSet implements driver.RowsNextResultSet.
+func (r *otelRowsNextResultSet) NextResultSet() error {
+	return r.parent.(driver.RowsNextResultSet).NextResultSet()
+}
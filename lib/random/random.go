@@ -0,0 +1,39 @@
+// Package random is a math/rand source shared by the packages (fault rates, retry jitter).
+// The global source of math/rand is not seeded with go 1.16, this one is seeded when the
+// process starts and is safe for concurrent use.
+package random
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// mu guards source, math/rand.Rand is not safe for concurrent use
+	mu     sync.Mutex
+	source = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Float64 returns a number in [0.0, 1.0).
+func Float64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return source.Float64()
+}
+
+// Int63n returns a number in [0, n), n must be positive.
+func Int63n(n int64) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return source.Int63n(n)
+}
+
+// Jitter returns d less a random part of up to half of it, so the clients backing off at
+// the same time don't all retry at the same time.
+func Jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d - time.Duration(Int63n(int64(d)/2+1))
+}
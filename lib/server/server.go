@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+)
+
+// DefaultShutdownTimeout is how long we wait for the in-flight requests and the telemetry flush
+// when SHUTDOWN_TIMEOUT is not set.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// ShutdownTimeoutFromEnv returns the shutdown deadline set in SHUTDOWN_TIMEOUT (e.g. "10s").
+func ShutdownTimeoutFromEnv() time.Duration {
+	return env.Duration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout)
+}
+
+// Run serves srv until ctx is done or the process receives SIGINT/SIGTERM.
+// Then it drains the http server and calls the onShutdown funcs in order (e.g. flushing the
+// telemetry), all of it within the given timeout.
+// The onShutdown funcs are called even if the server could not start.
+func Run(ctx context.Context, srv *http.Server, timeout time.Duration, onShutdown ...func(context.Context) error) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// the server couldn't start (or stopped by itself)
+	case <-ctx.Done():
+		log.Print("Shutting down...")
+	}
+
+	// Do not make the application hang when it is shutdown.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err == nil {
+		// Stop accepting new connections and wait for the in-flight requests
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Printf("failed to drain the http server: %v", shutdownErr)
+		}
+	}
+	for _, fn := range onShutdown {
+		if shutdownErr := fn(shutdownCtx); shutdownErr != nil {
+			log.Printf("shutdown: %v", shutdownErr)
+		}
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
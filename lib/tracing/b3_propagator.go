@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The zipkin b3 headers, https://github.com/openzipkin/b3-propagation
+const (
+	b3SingleHeader    = "b3"
+	b3TraceIDHeader   = "x-b3-traceid"
+	b3SpanIDHeader    = "x-b3-spanid"
+	b3SampledHeader   = "x-b3-sampled"
+	b3FlagsHeader     = "x-b3-flags"
+	b3SampledOn       = "1"
+	b3SampledOff      = "0"
+	b3SampledDebug    = "d"
+	b3SampledOnLegacy = "true"
+)
+
+// b3Propagator injects the b3 single header, or the X-B3-* headers if multi.
+// Both encodings are extracted, the single header first.
+// The sampling decision can't be deferred with the SpanContext of otel: no decision is
+// taken as not sampled.
+type b3Propagator struct {
+	multi bool
+}
+
+var _ propagation.TextMapPropagator = b3Propagator{}
+
+// Inject implements propagation.TextMapPropagator.
+func (p b3Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	sampled := b3SampledOff
+	if sc.IsSampled() {
+		sampled = b3SampledOn
+	}
+	if p.multi {
+		carrier.Set(b3TraceIDHeader, sc.TraceID().String())
+		carrier.Set(b3SpanIDHeader, sc.SpanID().String())
+		carrier.Set(b3SampledHeader, sampled)
+		return
+	}
+	carrier.Set(b3SingleHeader, sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sampled)
+}
+
+// Extract implements propagation.TextMapPropagator.
+func (p b3Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := extractB3Single(carrier.Get(b3SingleHeader))
+	if !ok {
+		sc, ok = extractB3Multi(carrier)
+	}
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields implements propagation.TextMapPropagator.
+func (p b3Propagator) Fields() []string {
+	if p.multi {
+		return []string{b3TraceIDHeader, b3SpanIDHeader, b3SampledHeader}
+	}
+	return []string{b3SingleHeader}
+}
+
+// extractB3Single parses {trace id}-{span id}[-{sampling state}[-{parent span id}]]
+func extractB3Single(value string) (trace.SpanContext, bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		// empty, or only a sampling state: there is no trace to join
+		return trace.SpanContext{}, false
+	}
+	sampled := ""
+	if len(parts) > 2 {
+		sampled = parts[2]
+	}
+	return b3SpanContext(parts[0], parts[1], sampled, "")
+}
+
+func extractB3Multi(carrier propagation.TextMapCarrier) (trace.SpanContext, bool) {
+	return b3SpanContext(carrier.Get(b3TraceIDHeader), carrier.Get(b3SpanIDHeader),
+		carrier.Get(b3SampledHeader), carrier.Get(b3FlagsHeader))
+}
+
+// b3SpanContext builds the SpanContext of the b3 values, the trace id can be 64 or 128 bits
+func b3SpanContext(traceID, spanID, sampled, flags string) (trace.SpanContext, bool) {
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var traceFlags trace.TraceFlags
+	switch strings.ToLower(sampled) {
+	case b3SampledOn, b3SampledDebug, b3SampledOnLegacy:
+		traceFlags = trace.FlagsSampled
+	}
+	if flags == "1" {
+		// debug implies sampled
+		traceFlags = trace.FlagsSampled
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: traceFlags,
+		Remote:     true,
+	})
+	return sc, sc.IsValid()
+}
@@ -0,0 +1,208 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The limits of the W3C baggage header, https://www.w3.org/TR/baggage/#limits
+const (
+	MaxBaggageBytes       = 8192
+	MaxBaggageMembers     = 180
+	MaxBaggageMemberBytes = 4096
+)
+
+// baggageHeader is the header of the W3C baggage propagator
+const baggageHeader = "baggage"
+
+// AllBaggageKeys in BaggagePolicy.AllowedKeys accepts any key
+const AllBaggageKeys = "*"
+
+// DefaultBaggageKeys are accepted when BAGGAGE_ALLOWED_KEYS is not set: the username set by
+// the client. They are only copied onto the spans if BAGGAGE_SPAN_ATTRIBUTES asks for it.
+const DefaultBaggageKeys = "username"
+
+// baggageDroppedKey is the number of members of the inbound baggage which were dropped,
+// on the server span
+const baggageDroppedKey = attribute.Key("baggage.dropped")
+
+// BaggagePolicy tells what is done with the baggage of the requests.
+type BaggagePolicy struct {
+	// AllowedKeys are the keys of the baggage accepted from the inbound requests, the other
+	// members are stripped before the baggage is extracted (AllBaggageKeys accepts all).
+	// The services can still add their own baggage, it is propagated downstream.
+	AllowedKeys []string
+	// SpanAttributeKeys are the keys of the baggage copied onto every span as attributes
+	SpanAttributeKeys []string
+}
+
+// BaggagePolicyFromEnv returns the BaggagePolicy of the comma separated keys of
+// BAGGAGE_ALLOWED_KEYS (DefaultBaggageKeys if not set, an empty value accepts no key) and
+// BAGGAGE_SPAN_ATTRIBUTES (none if not set, copying the baggage onto the spans is opt-in).
+func BaggagePolicyFromEnv() BaggagePolicy {
+	allowed, ok := os.LookupEnv("BAGGAGE_ALLOWED_KEYS")
+	if !ok {
+		allowed = DefaultBaggageKeys
+	}
+	return BaggagePolicy{
+		AllowedKeys:       splitList(allowed),
+		SpanAttributeKeys: splitList(os.Getenv("BAGGAGE_SPAN_ATTRIBUTES")),
+	}
+}
+
+func (p BaggagePolicy) allows(key string) bool {
+	for _, allowed := range p.AllowedKeys {
+		if allowed == AllBaggageKeys || allowed == key {
+			return true
+		}
+	}
+	return false
+}
+
+// currentBaggagePolicy is the policy of the inbound requests, set by Setup
+var currentBaggagePolicy atomic.Value
+
+func init() {
+	currentBaggagePolicy.Store(BaggagePolicy{})
+}
+
+// SetBaggagePolicy sets the policy applied by the handlers of NewHandler, Setup sets the
+// one of its Options.
+func SetBaggagePolicy(p BaggagePolicy) {
+	currentBaggagePolicy.Store(p)
+}
+
+func getBaggagePolicy() BaggagePolicy {
+	return currentBaggagePolicy.Load().(BaggagePolicy)
+}
+
+type baggageDroppedCtxKey struct{}
+
+// baggageHandler sanitizes the baggage header of the inbound requests before it is
+// extracted (trust boundary), see filterBaggage.
+type baggageHandler struct {
+	handler http.Handler
+}
+
+func (h *baggageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	values := r.Header.Values(baggageHeader)
+	if len(values) == 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	kept, dropped := filterBaggage(strings.Join(values, ","), getBaggagePolicy())
+	if dropped == 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	// the request is the caller's, we change a copy
+	r = r.WithContext(context.WithValue(r.Context(), baggageDroppedCtxKey{}, dropped))
+	r.Header = r.Header.Clone()
+	if kept == "" {
+		r.Header.Del(baggageHeader)
+	} else {
+		r.Header.Set(baggageHeader, kept)
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// recordDroppedBaggage records on the span of ctx how many members of the inbound baggage
+// were dropped, if any
+func recordDroppedBaggage(ctx context.Context) {
+	if dropped, ok := ctx.Value(baggageDroppedCtxKey{}).(int); ok {
+		trace.SpanFromContext(ctx).SetAttributes(baggageDroppedKey.Int(dropped))
+	}
+}
+
+// filterBaggage keeps the members of the baggage header which are allowed by p, within the
+// W3C limits: a member of more than MaxBaggageMemberBytes is dropped, and so are the
+// members after MaxBaggageMembers or MaxBaggageBytes. It returns the header of the members
+// kept and the number of members dropped.
+func filterBaggage(header string, p BaggagePolicy) (string, int) {
+	var kept []string
+	size, dropped := 0, 0
+	for _, member := range strings.Split(header, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		key := member
+		if i := strings.IndexAny(member, "=;"); i >= 0 {
+			key = member[:i]
+		}
+		key = strings.TrimSpace(key)
+
+		// the commas between the members count too
+		memberSize := len(member)
+		if len(kept) > 0 {
+			memberSize++
+		}
+		if !p.allows(key) || len(member) > MaxBaggageMemberBytes ||
+			len(kept) >= MaxBaggageMembers || size+memberSize > MaxBaggageBytes {
+			dropped++
+			continue
+		}
+		kept = append(kept, member)
+		size += memberSize
+	}
+	return strings.Join(kept, ","), dropped
+}
+
+// baggageSpanProcessor copies the baggage entries of keys onto every span when it starts
+type baggageSpanProcessor struct {
+	keys []attribute.Key
+}
+
+var _ sdktrace.SpanProcessor = baggageSpanProcessor{}
+
+// newBaggageSpanProcessor returns the processor promoting the baggage of keys to span
+// attributes, nil if there are none
+func newBaggageSpanProcessor(keys []string) sdktrace.SpanProcessor {
+	if len(keys) == 0 {
+		return nil
+	}
+	p := baggageSpanProcessor{}
+	for _, key := range keys {
+		p.keys = append(p.keys, attribute.Key(key))
+	}
+	return p
+}
+
+// OnStart implements sdktrace.SpanProcessor.
+func (p baggageSpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	set := baggage.Set(parent)
+	for _, key := range p.keys {
+		if value, ok := set.Value(key); ok {
+			// the baggage propagator keeps the properties of the member (;prop=...) in the value
+			s.SetAttributes(key.String(strings.SplitN(value.Emit(), ";", 2)[0]))
+		}
+	}
+}
+
+// OnEnd implements sdktrace.SpanProcessor.
+func (baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// Shutdown implements sdktrace.SpanProcessor.
+func (baggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush implements sdktrace.SpanProcessor.
+func (baggageSpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// splitList splits a comma separated list, without the blanks
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
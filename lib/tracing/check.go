@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"net"
+	"net/url"
+
+	"medium-opentelemetry-poc/lib/health"
+)
+
+// ExporterCheck returns the health check of the connection to the backend the traces are
+// exported to (otel agent/collector or jaeger collector), nil when there is nothing to
+// check: stdout, file, or the jaeger agent over UDP.
+func ExporterCheck(opts Options) health.Check {
+	if addr := exporterAddr(opts); addr != "" {
+		return health.TCPCheck(addr)
+	}
+	return nil
+}
+
+// exporterAddr is the host:port the traces are exported to, empty if it can't be checked
+func exporterAddr(opts Options) string {
+	switch opts.Exporter {
+	case ExporterOTelCollector:
+		return opts.OTLP.Endpoint
+	case ExporterJaegerCollector:
+		if opts.Jaeger.Mode != JaegerModeCollector {
+			return ""
+		}
+		u, err := url.Parse(opts.Jaeger.CollectorURL)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		if u.Port() != "" {
+			return u.Host
+		}
+		if u.Scheme == "https" {
+			return net.JoinHostPort(u.Hostname(), "443")
+		}
+		return net.JoinHostPort(u.Hostname(), "80")
+	default:
+		return ""
+	}
+}
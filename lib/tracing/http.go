@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// The RED metrics recorded by NewHandler on top of the otelhttp ones
+// (http.server.duration is the latency histogram, in microseconds)
+const (
+	serverRequestsMetric = "http.server.requests"
+	serverErrorsMetric   = "http.server.errors"
+)
+
+// NewHandler wraps handler for tracing (same as otelhttp.NewHandler) and records the RED
+// metrics of the route: request count, error count (5xx) and the latency histogram.
+// The inbound baggage is filtered by the BaggagePolicy before it is extracted.
+func NewHandler(handler http.Handler, operation string) http.Handler {
+	meter := metric.Must(global.Meter("medium-opentelemetry-poc/lib/tracing"))
+	red := &redHandler{
+		handler:   handler,
+		operation: operation,
+		requests: meter.NewInt64Counter(serverRequestsMetric,
+			metric.WithDescription("Number of requests handled by the route")),
+		errors: meter.NewInt64Counter(serverErrorsMetric,
+			metric.WithDescription("Number of requests of the route answered with a 5xx status code")),
+	}
+	return &baggageHandler{handler: otelhttp.NewHandler(red, operation)}
+}
+
+type redHandler struct {
+	handler   http.Handler
+	operation string
+	requests  metric.Int64Counter
+	errors    metric.Int64Counter
+}
+
+func (h *redHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recordDroppedBaggage(r.Context())
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	h.handler.ServeHTTP(sw, r)
+
+	labels := []attribute.KeyValue{
+		attribute.String("operation", h.operation),
+		semconv.HTTPMethodKey.String(r.Method),
+		semconv.HTTPStatusCodeKey.Int(sw.status),
+	}
+	ctx := r.Context()
+	h.requests.Add(ctx, 1, labels...)
+	if sw.status >= http.StatusInternalServerError {
+		h.errors.Add(ctx, 1, labels...)
+	}
+}
+
+// statusWriter remembers the status code written by the handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
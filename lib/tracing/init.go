@@ -1,7 +1,12 @@
 package tracing
 
 import (
+	"fmt"
 	"log"
+	"net/http"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/trace/jaeger"
@@ -10,49 +15,106 @@ import (
 	"go.opentelemetry.io/otel/semconv"
 )
 
+// The values accepted by JaegerEndpoint.Mode (JAEGER_EXPORT_MODE)
+const (
+	// JaegerModeAgent sends the spans to the jaeger agent over UDP (default)
+	JaegerModeAgent = "agent"
+	// JaegerModeCollector posts the spans (Thrift batches) straightly to the jaeger collector over HTTP,
+	// useful for the services that are not in the same network as the agent
+	JaegerModeCollector = "collector"
+)
+
+// JaegerEndpoint tells the jaeger exporter where to send the spans to.
+type JaegerEndpoint struct {
+	// Mode is either JaegerModeAgent or JaegerModeCollector
+	Mode string
+
+	AgentHost string
+	AgentPort string
+
+	// CollectorURL is the HTTP endpoint of the collector, e.g. http://localhost:14268/api/traces
+	CollectorURL string
+	// Username and Password are sent as basic auth to the collector, if both are set
+	Username string
+	Password string
+}
+
+// JaegerEndpointFromEnv returns the JaegerEndpoint set in the environment variables.
+func JaegerEndpointFromEnv() JaegerEndpoint {
+	return JaegerEndpoint{
+		Mode:         env.Get("JAEGER_EXPORT_MODE", JaegerModeAgent),
+		AgentHost:    env.Get("JAEGER_AGENT_NAME", "localhost"),
+		AgentPort:    env.Get("JAEGER_AGENT_PORT", "5775"),
+		CollectorURL: env.Get("JAEGER_COLLECTOR_URL", "http://localhost:14268/api/traces"),
+		Username:     env.Get("JAEGER_USER", ""),
+		Password:     env.Get("JAEGER_PASSWORD", ""),
+	}
+}
+
 // tracerProvider returns an OpenTelemetry TracerProvider configured to use
-// the Jaeger exporter that will send spans to the provided url. The returned
+// the Jaeger exporter that will send spans to the provided endpoint. The returned
 // TracerProvider will also use a Resource configured with all the information
 // about the application.
-func TracerProvider(collectorUrl string, agentHostName string, agentPort string, service string, environment string, id int64) (*tracesdk.TracerProvider, error) {
-	log.Println("Agent Hostname=", agentHostName)
-	log.Println("agentport=", agentPort)
+func TracerProvider(endpoint JaegerEndpoint, service string, environment string, id int64) (*tracesdk.TracerProvider, error) {
+	// Record information about this application in an Resource.
+	res := resource.NewWithAttributes(
+		semconv.ServiceNameKey.String(service),
+		attribute.String("environment", environment),
+		attribute.Int64("ID", id),
+	)
+	return newJaegerTracerProvider(endpoint, res, tracesdk.AlwaysSample(), nil)
+}
+
+// newJaegerTracerProvider builds the TracerProvider exporting to jaeger, shared by
+// TracerProvider and Setup. The spans are redacted by redactor, if not nil.
+func newJaegerTracerProvider(endpoint JaegerEndpoint, res *resource.Resource, sampler tracesdk.Sampler, redactor *Redactor) (*tracesdk.TracerProvider, error) {
 	// Create the Jaeger exporter
 	// Exporters are packages that allow telemetry data to be emitted somewhere
-	// Sending to the agent
-	// exp, err := jaeger.NewRawExporter(jaeger.WithAgentEndpoint(jaeger.WithAgentHost("jaeger-agent"), jaeger.WithAgentPort("5775")))
-	// exp, err := jaeger.NewRawExporter(jaeger.WithAgentEndpoint())
-	// if we don't specify the name gonna be localhost(work in local scenario and tests)
-	//  exp, err := jaeger.NewRawExporter(jaeger.WithAgentEndpoint(jaeger.WithAgentPort("5775")))
-	// in case of docker image we need to specify and pass the both (agent name and port)
-	exp, err := jaeger.NewRawExporter(jaeger.WithAgentEndpoint(jaeger.WithAgentHost(agentHostName), jaeger.WithAgentPort(agentPort)))
-
-	// Sending directly to collector (optional)
-	// exp, err := jaeger.NewRawExporter(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(collectorUrl)))
-	// Use http://localhost:14268/api/traces as default Jaeger collector endpoint instead of http://localhost:14250. (#1898)
-	// This gonna be fixed in next release and we don't need to path the url to here
-	//exp, err := jaeger.NewRawExporter(jaeger.WithCollectorEndpoint())
-
+	endpointOption, err := jaegerEndpointOption(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := jaeger.NewRawExporter(endpointOption)
 	if err != nil {
 		return nil, err
 	}
 
 	// This block of code will create a new batch span processor,
 	// a type of span processor that batches up multiple spans over a period of time, that writes to the exporter we created in the above
-	bsp := tracesdk.NewBatchSpanProcessor(exp)
+	// (once redacted, see NewRedactingExporter)
+	bsp := tracesdk.NewBatchSpanProcessor(NewRedactingExporter(exp, redactor))
 	tp := tracesdk.NewTracerProvider(
 		tracesdk.WithSpanProcessor(bsp),
 		// Default is always sample
-		tracesdk.WithSampler(tracesdk.AlwaysSample()),
+		tracesdk.WithSampler(sampler),
 		// same as using bsp (shorter way)
 		// tracesdk.WithBatcher(exp),
-		// Record information about this application in an Resource.
-		tracesdk.WithResource(resource.NewWithAttributes(
-			semconv.ServiceNameKey.String(service),
-			attribute.String("environment", environment),
-			attribute.Int64("ID", id),
-		),
-		),
+		tracesdk.WithResource(res),
 	)
 	return tp, nil
 }
+
+func jaegerEndpointOption(endpoint JaegerEndpoint) (jaeger.EndpointOption, error) {
+	switch endpoint.Mode {
+	case JaegerModeCollector:
+		log.Println("Jaeger collector=", endpoint.CollectorURL)
+		// Sending directly to collector, we always pass the url since the exporter default
+		// is http://localhost:14250 (grpc port) instead of http://localhost:14268/api/traces
+		return jaeger.WithCollectorEndpoint(
+			jaeger.WithEndpoint(endpoint.CollectorURL),
+			jaeger.WithUsername(endpoint.Username),
+			jaeger.WithPassword(endpoint.Password),
+			// don't let a hung collector block the batch span processor forever
+			jaeger.WithHTTPClient(&http.Client{Timeout: 10 * time.Second}),
+		), nil
+	case JaegerModeAgent:
+		log.Println("Agent Hostname=", endpoint.AgentHost)
+		log.Println("agentport=", endpoint.AgentPort)
+		// Sending to the agent
+		// if we don't specify the name gonna be localhost(work in local scenario and tests)
+		// in case of docker image we need to specify and pass the both (agent name and port)
+		return jaeger.WithAgentEndpoint(jaeger.WithAgentHost(endpoint.AgentHost), jaeger.WithAgentPort(endpoint.AgentPort)), nil
+	default:
+		return nil, fmt.Errorf("unknown jaeger export mode %q", endpoint.Mode)
+	}
+}
@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// collectorRequest is what the stand-in collector received
+type collectorRequest struct {
+	method      string
+	contentType string
+	username    string
+	password    string
+	hasAuth     bool
+	body        []byte
+}
+
+func newStandInCollector(t *testing.T) (*httptest.Server, func() []collectorRequest) {
+	var mu sync.Mutex
+	var received []collectorRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read the batch: %v", err)
+		}
+		username, password, ok := r.BasicAuth()
+		mu.Lock()
+		received = append(received, collectorRequest{
+			method:      r.Method,
+			contentType: r.Header.Get("Content-Type"),
+			username:    username,
+			password:    password,
+			hasAuth:     ok,
+			body:        body,
+		})
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []collectorRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]collectorRequest(nil), received...)
+	}
+}
+
+func exportOneSpan(t *testing.T, endpoint JaegerEndpoint, spanName string) {
+	tp, err := TracerProvider(endpoint, "test-service", "test", 1)
+	if err != nil {
+		t.Fatalf("failed to create the tracer provider: %v", err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), spanName)
+	span.End()
+	// Shutdown flushes the batch span processor
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shutdown the tracer provider: %v", err)
+	}
+}
+
+func TestTracerProviderCollectorMode(t *testing.T) {
+	srv, received := newStandInCollector(t)
+
+	exportOneSpan(t, JaegerEndpoint{
+		Mode:         JaegerModeCollector,
+		CollectorURL: srv.URL + "/api/traces",
+		Username:     "jaeger",
+		Password:     "secret",
+	}, "collector-span")
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 batch posted to the collector, got %d", len(requests))
+	}
+	req := requests[0]
+	if req.method != http.MethodPost {
+		t.Errorf("expected a POST, got %s", req.method)
+	}
+	if req.contentType != "application/x-thrift" {
+		t.Errorf("expected a thrift batch, got content type %q", req.contentType)
+	}
+	if !req.hasAuth || req.username != "jaeger" || req.password != "secret" {
+		t.Errorf("expected basic auth jaeger/secret, got %q/%q (set: %t)", req.username, req.password, req.hasAuth)
+	}
+	// strings are written as is in the thrift binary protocol
+	for _, want := range []string{"collector-span", "test-service"} {
+		if !bytes.Contains(req.body, []byte(want)) {
+			t.Errorf("expected the batch to contain %q", want)
+		}
+	}
+}
+
+func TestTracerProviderCollectorModeWithoutAuth(t *testing.T) {
+	srv, received := newStandInCollector(t)
+
+	exportOneSpan(t, JaegerEndpoint{
+		Mode:         JaegerModeCollector,
+		CollectorURL: srv.URL,
+	}, "anonymous-span")
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 batch posted to the collector, got %d", len(requests))
+	}
+	if requests[0].hasAuth {
+		t.Errorf("expected no basic auth, got %q/%q", requests[0].username, requests[0].password)
+	}
+}
+
+func TestTracerProviderUnknownMode(t *testing.T) {
+	if _, err := TracerProvider(JaegerEndpoint{Mode: "carrier-pigeon"}, "test-service", "test", 1); err == nil {
+		t.Fatal("expected an error for an unknown jaeger export mode")
+	}
+}
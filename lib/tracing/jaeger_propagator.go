@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jaegerHeader is the header of the jaeger clients:
+// {trace id}:{span id}:{parent span id}:{flags}, https://www.jaegertracing.io/docs/client-libraries/#propagation-format
+const jaegerHeader = "uber-trace-id"
+
+// The bits of the jaeger flags
+const (
+	jaegerFlagSampled = 0x01
+	jaegerFlagDebug   = 0x02
+)
+
+// jaegerPropagator propagates the uber-trace-id header of the jaeger clients. The baggage
+// of the jaeger clients (uberctx-* headers) is not propagated, use the W3C baggage.
+type jaegerPropagator struct{}
+
+var _ propagation.TextMapPropagator = jaegerPropagator{}
+
+// Inject implements propagation.TextMapPropagator.
+func (jaegerPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	flags := 0
+	if sc.IsSampled() {
+		flags = jaegerFlagSampled
+	}
+	// the parent span id is deprecated, always 0
+	carrier.Set(jaegerHeader, fmt.Sprintf("%s:%s:0:%x", sc.TraceID(), sc.SpanID(), flags))
+}
+
+// Extract implements propagation.TextMapPropagator.
+func (jaegerPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := extractJaeger(carrier.Get(jaegerHeader))
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields implements propagation.TextMapPropagator.
+func (jaegerPropagator) Fields() []string {
+	return []string{jaegerHeader}
+}
+
+func extractJaeger(value string) (trace.SpanContext, bool) {
+	// some clients url-encode the colons
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		value = unescaped
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 || len(parts[0]) > 32 || len(parts[1]) > 16 {
+		return trace.SpanContext{}, false
+	}
+	// the ids are written without their leading zeros
+	tid, err := trace.TraceIDFromHex(fmt.Sprintf("%032s", parts[0]))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	sid, err := trace.SpanIDFromHex(fmt.Sprintf("%016s", parts[1]))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var traceFlags trace.TraceFlags
+	if flags&(jaegerFlagSampled|jaegerFlagDebug) != 0 {
+		traceFlags = trace.FlagsSampled
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: traceFlags,
+		Remote:     true,
+	})
+	return sc, sc.IsValid()
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// jsonExporter writes every finished span as its own JSON document, so the file mode
+// ends up with newline-delimited JSON which is easy to grep or to feed to jq.
+type jsonExporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	encoder *json.Encoder
+}
+
+// newStdoutExporter writes the spans to stdout as pretty JSON (for local debugging)
+func newStdoutExporter() *jsonExporter {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+	return &jsonExporter{w: os.Stdout, encoder: encoder}
+}
+
+// newFileExporter appends the spans to the file at path as newline-delimited JSON
+func newFileExporter(path string) (*jsonExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonExporter{w: f, closer: f, encoder: json.NewEncoder(f)}, nil
+}
+
+// ExportSpans writes the spans, one JSON document per span.
+func (e *jsonExporter) ExportSpans(ctx context.Context, spans []*sdktrace.SpanSnapshot) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.w == nil {
+		// already shut down
+		return nil
+	}
+	for _, span := range spans {
+		if err := e.encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown closes the file, if any.
+func (e *jsonExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w = nil
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
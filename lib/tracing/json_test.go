@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jsonSpan is the part of the exported JSON of a span the tests look at
+type jsonSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	Attributes  []struct {
+		Key   string
+		Value struct{ Type, Value string }
+	}
+}
+
+// readJSONLines decodes the spans of the newline-delimited JSON file at path
+func readJSONLines(t *testing.T, path string) []jsonSpan {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []jsonSpan
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var span jsonSpan
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("line %d is not a JSON span: %v\n%s", len(spans)+1, err, scanner.Text())
+		}
+		spans = append(spans, span)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	exporter, err := newFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.WithAttributes(attribute.String("person.title", "Ms.")))
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shutdown the tracer provider: %v", err)
+	}
+
+	spans := readJSONLines(t, path)
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("expected a line per span in the order they ended, got %+v", spans)
+	}
+	if got, want := spans[0].Parent, spans[1].SpanContext; got != want {
+		t.Errorf("expected the parent of the child to be %+v, got %+v", want, got)
+	}
+	if got := spans[1].SpanContext.TraceID; got != parent.SpanContext().TraceID().String() {
+		t.Errorf("expected the trace id %s, got %s", parent.SpanContext().TraceID(), got)
+	}
+	if attrs := spans[1].Attributes; len(attrs) != 1 || attrs[0].Key != "person.title" || attrs[0].Value.Value != "Ms." {
+		t.Errorf("expected the attribute person.title=Ms., got %+v", attrs)
+	}
+
+	// spans ended after the shutdown are not written
+	if err := exporter.ExportSpans(context.Background(), []*sdktrace.SpanSnapshot{{Name: "late"}}); err != nil {
+		t.Errorf("expected no error once shut down, got %v", err)
+	}
+	if got := readJSONLines(t, path); len(got) != 2 {
+		t.Errorf("expected nothing written once shut down, got %d spans", len(got))
+	}
+}
+
+func TestFileExporterAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	for _, name := range []string{"first run", "second run"} {
+		exporter, err := newFileExporter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exporter.ExportSpans(context.Background(), []*sdktrace.SpanSnapshot{{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := exporter.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := readJSONLines(t, path)
+	if len(spans) != 2 || spans[0].Name != "first run" || spans[1].Name != "second run" {
+		t.Errorf("expected the spans of both runs, got %+v", spans)
+	}
+}
+
+func TestFileExporterInvalidPath(t *testing.T) {
+	if _, err := newFileExporter(filepath.Join(t.TempDir(), "missing", "spans.json")); err == nil {
+		t.Error("expected an error for a file in a missing directory")
+	}
+}
@@ -0,0 +1,171 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/host"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/metric/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/histogram"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// DefaultCollectPeriod is how often the metrics are collected (and pushed) when
+// OTEL_METRIC_EXPORT_INTERVAL is not set
+const DefaultCollectPeriod = 2 * time.Second
+
+// latencyBoundaries are the buckets of the latency histograms, in microseconds (same as otelhttp)
+var latencyBoundaries = []float64{
+	1000, 5000, 10000, 25000, 50000, 100000, 250000, 500000, 1000000, 2500000, 5000000, 10000000,
+}
+
+// nanosecondsBoundaries are the buckets of the histograms recorded in nanoseconds (e.g. runtime.go.gc.pause_ns)
+var nanosecondsBoundaries = []float64{
+	10000, 50000, 100000, 250000, 500000, 1000000, 5000000, 10000000, 50000000, 100000000,
+}
+
+// setupMetrics builds the meter provider and registers it as the global one.
+// The metrics are pushed to pushExporter (if not nil) and/or exposed for prometheus on
+// opts.PrometheusAddr (if set), both of them read the same controller.
+func setupMetrics(ctx context.Context, opts Options, res *resource.Resource, pushExporter export.Exporter) (ShutdownFunc, error) {
+	if pushExporter == nil && opts.PrometheusAddr == "" {
+		// nobody would read the metrics, the global meter provider stays a no-op
+		return func(context.Context) error { return nil }, nil
+	}
+
+	if opts.CollectPeriod <= 0 {
+		opts.CollectPeriod = DefaultCollectPeriod
+	}
+
+	// prometheus expects cumulative values, the OTLP exporter is fine with them as well
+	var exportKind export.ExportKindSelector = export.CumulativeExportKindSelector()
+	if opts.PrometheusAddr == "" {
+		exportKind = pushExporter
+	}
+
+	contOpts := []controller.Option{
+		controller.WithCollectPeriod(opts.CollectPeriod),
+		controller.WithResource(res),
+	}
+	if pushExporter != nil {
+		contOpts = append(contOpts, controller.WithExporter(pushExporter))
+	}
+	cont := controller.New(
+		processor.New(
+			// the value recorders (e.g. the request latency) are aggregated as histograms
+			histogramSelector{
+				latency:     simple.NewWithHistogramDistribution(histogram.WithExplicitBoundaries(latencyBoundaries)),
+				nanoseconds: simple.NewWithHistogramDistribution(histogram.WithExplicitBoundaries(nanosecondsBoundaries)),
+			},
+			exportKind,
+			processor.WithMemory(opts.PrometheusAddr != ""),
+		),
+		contOpts...,
+	)
+
+	var admin *http.Server
+	if opts.PrometheusAddr != "" {
+		// the resource (service.name, environment, ...) is added to the labels of every metric
+		exporter, err := prometheus.NewExporter(prometheus.Config{DefaultHistogramBoundaries: latencyBoundaries}, cont)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the prometheus exporter: %w", err)
+		}
+		admin = startAdminServer(opts.PrometheusAddr, exporter)
+	}
+	// the admin server doesn't outlive a failed setup
+	fail := func(err error) (ShutdownFunc, error) {
+		if admin != nil {
+			admin.Close()
+		}
+		return nil, err
+	}
+
+	global.SetMeterProvider(cont.MeterProvider())
+
+	// goroutines, GC pauses, heap... and the CPU/memory of the process and host, tagged with
+	// the same resource as the traces
+	if err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(opts.CollectPeriod)); err != nil {
+		return fail(fmt.Errorf("failed to start the runtime metrics: %w", err))
+	}
+	if err := host.Start(); err != nil {
+		return fail(fmt.Errorf("failed to start the host metrics: %w", err))
+	}
+
+	if pushExporter != nil {
+		if opts.PrometheusAddr != "" {
+			// the controller is collecting by itself, so a scrape can't trigger a collection
+			// and just reads the last one, no need to log that
+			otel.SetErrorHandler(ignoreControllerStarted{})
+		}
+		if err := cont.Start(ctx); err != nil {
+			return fail(fmt.Errorf("failed to start metric controller: %w", err))
+		}
+	}
+
+	var steps []ShutdownFunc
+	if admin != nil {
+		steps = append(steps, admin.Shutdown)
+	}
+	if pushExporter != nil {
+		// The controller pushes one last collection on Stop
+		steps = append(steps, cont.Stop)
+	}
+	return func(ctx context.Context) error {
+		// the controller is stopped even if the admin server doesn't shut down in time
+		return shutdownAll(ctx, steps...)
+	}, nil
+}
+
+// histogramSelector picks the histogram buckets by the unit of the instrument,
+// the nanoseconds ones would all end up in the last latency bucket otherwise
+type histogramSelector struct {
+	latency     export.AggregatorSelector
+	nanoseconds export.AggregatorSelector
+}
+
+func (s histogramSelector) AggregatorFor(descriptor *metric.Descriptor, aggPtrs ...*export.Aggregator) {
+	if strings.HasSuffix(descriptor.Name(), "_ns") {
+		s.nanoseconds.AggregatorFor(descriptor, aggPtrs...)
+		return
+	}
+	s.latency.AggregatorFor(descriptor, aggPtrs...)
+}
+
+// startAdminServer serves the prometheus metrics on a separate port than the service itself
+func startAdminServer(addr string, metrics http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("Serving the metrics on http://%s/metrics", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("admin server: %v", err)
+		}
+	}()
+	return srv
+}
+
+// ignoreControllerStarted logs the errors of the otel sdk, same as the default handler,
+// except controller.ErrControllerStarted which is expected when prometheus scrapes a pushing controller
+type ignoreControllerStarted struct{}
+
+func (ignoreControllerStarted) Handle(err error) {
+	if errors.Is(err, controller.ErrControllerStarted) {
+		return
+	}
+	log.Print(err)
+}
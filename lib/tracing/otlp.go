@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+)
+
+// The values accepted by OTLPConfig.Protocol (OTEL_EXPORTER_OTLP_PROTOCOL)
+const (
+	OTLPProtocolGRPC         = "grpc"
+	OTLPProtocolHTTPProtobuf = "http/protobuf"
+	OTLPProtocolHTTPJSON     = "http/json"
+)
+
+// The default receivers of the otel agent (see otel-config/config-agent.yaml)
+const (
+	defaultOTLPGRPCEndpoint = "127.0.0.1:4317"
+	defaultOTLPHTTPEndpoint = "127.0.0.1:55681"
+)
+
+// OTLPConfig tells the OTLP exporter where and how to send the telemetry.
+type OTLPConfig struct {
+	// Protocol is grpc (default), http/protobuf or http/json. The HTTP ones are handy
+	// behind the proxies which block HTTP/2
+	Protocol string
+	// Endpoint is the host:port of the otel agent/collector
+	Endpoint string
+	// Headers are sent with every export request (e.g. authentication)
+	Headers map[string]string
+	// Compression is either "gzip" or empty (or "none") for no compression
+	Compression string
+	// Timeout of every export request, zero keeps the exporter default (10s)
+	Timeout time.Duration
+}
+
+// OTLPConfigFromEnv returns the OTLPConfig set in the OTEL_EXPORTER_OTLP_* environment variables.
+func OTLPConfigFromEnv() OTLPConfig {
+	cfg := OTLPConfig{
+		Protocol:    env.Get("OTEL_EXPORTER_OTLP_PROTOCOL", OTLPProtocolGRPC),
+		Endpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		Headers:     parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		Compression: os.Getenv("OTEL_EXPORTER_OTLP_COMPRESSION"),
+	}
+	if cfg.Endpoint == "" {
+		// setting default endpoint for exporter
+		// in case of sidecar gonna work as well
+		cfg.Endpoint = defaultOTLPGRPCEndpoint
+		if cfg.Protocol != OTLPProtocolGRPC {
+			cfg.Endpoint = defaultOTLPHTTPEndpoint
+		}
+	}
+	// same as the spec, the timeout is in milliseconds
+	if timeout := os.Getenv("OTEL_EXPORTER_OTLP_TIMEOUT"); timeout != "" {
+		if ms, err := strconv.Atoi(timeout); err == nil {
+			cfg.Timeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return cfg
+}
+
+// newOTLPDriver creates the driver (grpc or http) of the OTLP exporter
+func newOTLPDriver(cfg OTLPConfig) (otlp.ProtocolDriver, error) {
+	compression, err := otlpCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Protocol {
+	case OTLPProtocolGRPC:
+		opts := []otlpgrpc.Option{
+			otlpgrpc.WithInsecure(),
+			otlpgrpc.WithEndpoint(cfg.Endpoint),
+			otlpgrpc.WithDialOption(),
+			// otlpgrpc.WithDialOption(grpc.WithBlock()), // useful for testing/debuging
+			// because it's not going to pass this line if it couldn't find and connect to the agent
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpgrpc.WithHeaders(cfg.Headers))
+		}
+		if compression == otlp.GzipCompression {
+			opts = append(opts, otlpgrpc.WithCompressor("gzip"))
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, otlpgrpc.WithTimeout(cfg.Timeout))
+		}
+		return otlpgrpc.NewDriver(opts...), nil
+
+	case OTLPProtocolHTTPProtobuf, OTLPProtocolHTTPJSON:
+		marshaler := otlp.MarshalProto
+		if cfg.Protocol == OTLPProtocolHTTPJSON {
+			marshaler = otlp.MarshalJSON
+		}
+		opts := []otlphttp.Option{
+			otlphttp.WithInsecure(),
+			otlphttp.WithEndpoint(cfg.Endpoint),
+			otlphttp.WithMarshal(marshaler),
+			otlphttp.WithCompression(compression),
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlphttp.WithHeaders(cfg.Headers))
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, otlphttp.WithTimeout(cfg.Timeout))
+		}
+		return otlphttp.NewDriver(opts...), nil
+
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.Protocol)
+	}
+}
+
+func otlpCompression(compression string) (otlp.Compression, error) {
+	switch compression {
+	case "", "none":
+		return otlp.NoCompression, nil
+	case "gzip":
+		return otlp.GzipCompression, nil
+	default:
+		return otlp.NoCompression, fmt.Errorf("unknown OTLP compression %q", compression)
+	}
+}
+
+// parseHeaders parses the W3C correlation-context like format of OTEL_EXPORTER_OTLP_HEADERS,
+// e.g. "api-key=secret,tenant=dev"
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		nameValue := strings.SplitN(pair, "=", 2)
+		if len(nameValue) != 2 {
+			continue
+		}
+		name, err := url.QueryUnescape(strings.TrimSpace(nameValue[0]))
+		if err != nil || name == "" {
+			continue
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(nameValue[1]))
+		if err != nil {
+			continue
+		}
+		headers[name] = value
+	}
+	return headers
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        map[string]string
+	}{
+		{name: "empty", value: "", want: map[string]string{}},
+		{name: "pairs", value: "api-key=secret,tenant=dev", want: map[string]string{"api-key": "secret", "tenant": "dev"}},
+		{name: "spaces", value: " api-key = secret , tenant=dev ", want: map[string]string{"api-key": "secret", "tenant": "dev"}},
+		{name: "url-encoded", value: "Authorization=Basic%20YTpi%3D%3D,x%2Dtenant=d%C3%A9v", want: map[string]string{"Authorization": "Basic YTpi==", "x-tenant": "dév"}},
+		{name: "= in the value", value: "token=a=b", want: map[string]string{"token": "a=b"}},
+		{name: "empty value", value: "api-key=", want: map[string]string{"api-key": ""}},
+		{name: "missing =", value: "api-key,tenant=dev", want: map[string]string{"tenant": "dev"}},
+		{name: "empty key", value: "=secret, =dev,tenant=dev", want: map[string]string{"tenant": "dev"}},
+		{name: "bad escape", value: "api-key=%zz,ten%zzant=dev,tenant=dev", want: map[string]string{"tenant": "dev"}},
+		{name: "last one wins", value: "tenant=dev,tenant=prod", want: map[string]string{"tenant": "prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseHeaders(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewOTLPDriver(t *testing.T) {
+	tests := []struct {
+		protocol, compression string
+		wantErr               bool
+	}{
+		{protocol: OTLPProtocolGRPC},
+		{protocol: OTLPProtocolGRPC, compression: "gzip"},
+		{protocol: OTLPProtocolGRPC, compression: "none"},
+		{protocol: OTLPProtocolHTTPProtobuf, compression: "gzip"},
+		{protocol: OTLPProtocolHTTPJSON},
+		{protocol: "http", wantErr: true},
+		{protocol: "", wantErr: true},
+		{protocol: "HTTP/JSON", wantErr: true},
+		{protocol: OTLPProtocolGRPC, compression: "brotli", wantErr: true},
+		{protocol: OTLPProtocolHTTPProtobuf, compression: "GZIP", wantErr: true},
+		{protocol: OTLPProtocolHTTPJSON, compression: "zstd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol+" "+tt.compression, func(t *testing.T) {
+			driver, err := newOTLPDriver(OTLPConfig{Protocol: tt.protocol, Endpoint: defaultOTLPHTTPEndpoint, Compression: tt.compression})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got the driver %T", driver)
+				}
+				return
+			}
+			if err != nil || driver == nil {
+				t.Errorf("expected a driver, got %v", err)
+			}
+		})
+	}
+}
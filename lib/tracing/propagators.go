@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"fmt"
+	"strings"
+
+	"medium-opentelemetry-poc/lib/env"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// The propagators accepted by OTEL_PROPAGATORS, a comma separated list like the spec.
+// On extraction, the last propagator of the list which finds a trace context wins.
+const (
+	// PropagatorTraceContext is the W3C traceparent/tracestate headers
+	PropagatorTraceContext = "tracecontext"
+	// PropagatorBaggage is the W3C baggage header
+	PropagatorBaggage = "baggage"
+	// PropagatorB3 is the zipkin b3 single header
+	PropagatorB3 = "b3"
+	// PropagatorB3Multi is the zipkin X-B3-* headers
+	PropagatorB3Multi = "b3multi"
+	// PropagatorJaeger is the jaeger uber-trace-id header
+	PropagatorJaeger = "jaeger"
+	// PropagatorXRay is the AWS X-Amzn-Trace-Id header
+	PropagatorXRay = "xray"
+	// PropagatorNone propagates nothing, alone in the list
+	PropagatorNone = "none"
+)
+
+// DefaultPropagators is used when OTEL_PROPAGATORS is not set, the W3C headers
+const DefaultPropagators = PropagatorTraceContext + "," + PropagatorBaggage
+
+// NewPropagator returns the composite propagator of the comma separated list of propagators
+// (e.g. "tracecontext,baggage,b3multi"), injecting all of them in the given order.
+func NewPropagator(names string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3Propagator{})
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3Propagator{multi: true})
+		case PropagatorJaeger:
+			propagators = append(propagators, jaegerPropagator{})
+		case PropagatorXRay:
+			propagators = append(propagators, xray.Propagator{})
+		case PropagatorNone:
+		default:
+			return nil, fmt.Errorf("unknown propagator %q in %q", name, names)
+		}
+	}
+	if seen[PropagatorNone] && len(seen) > 1 {
+		return nil, fmt.Errorf("the propagator %q can't be combined with others: %q", PropagatorNone, names)
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// PropagatorFromEnv returns the propagator of OTEL_PROPAGATORS (DefaultPropagators if not set),
+// for the programs which don't go through Setup (e.g. the client).
+func PropagatorFromEnv() (propagation.TextMapPropagator, error) {
+	return NewPropagator(env.Get("OTEL_PROPAGATORS", DefaultPropagators))
+}
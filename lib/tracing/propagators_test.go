@@ -0,0 +1,291 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+// remoteSpanContext is the SpanContext the propagators should extract
+func remoteSpanContext(t *testing.T, traceID, spanID string, sampled bool) trace.SpanContext {
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: flags, Remote: true})
+}
+
+// extract runs the propagator over headers, and returns the SpanContext found (invalid if none)
+func extract(p propagation.TextMapPropagator, headers map[string]string) trace.SpanContext {
+	carrier := propagation.HeaderCarrier(http.Header{})
+	for key, value := range headers {
+		carrier.Set(key, value)
+	}
+	return trace.SpanContextFromContext(p.Extract(context.Background(), carrier))
+}
+
+// roundTrip injects sc with p, and extracts it back. It returns the headers injected.
+func roundTrip(t *testing.T, p propagation.TextMapPropagator, sc trace.SpanContext) http.Header {
+	header := http.Header{}
+	p.Inject(trace.ContextWithSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+	got := trace.SpanContextFromContext(p.Extract(context.Background(), propagation.HeaderCarrier(header)))
+	if !got.Equal(sc) {
+		t.Errorf("expected %+v back from %v, got %+v", sc, header, got)
+	}
+	return header
+}
+
+func TestB3RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		multi   bool
+		sampled bool
+		want    map[string]string
+	}{
+		{name: "single sampled", sampled: true, want: map[string]string{"b3": testTraceID + "-" + testSpanID + "-1"}},
+		{name: "single not sampled", want: map[string]string{"b3": testTraceID + "-" + testSpanID + "-0"}},
+		{name: "multi sampled", multi: true, sampled: true, want: map[string]string{
+			"X-B3-Traceid": testTraceID, "X-B3-Spanid": testSpanID, "X-B3-Sampled": "1",
+		}},
+		{name: "multi not sampled", multi: true, want: map[string]string{
+			"X-B3-Traceid": testTraceID, "X-B3-Spanid": testSpanID, "X-B3-Sampled": "0",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := roundTrip(t, b3Propagator{multi: tt.multi}, remoteSpanContext(t, testTraceID, testSpanID, tt.sampled))
+			if len(header) != len(tt.want) {
+				t.Errorf("expected the headers %v, got %v", tt.want, header)
+			}
+			for key, value := range tt.want {
+				if got := header.Get(key); got != value {
+					t.Errorf("expected %s: %q, got %q", key, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestB3Extract(t *testing.T) {
+	padded64 := "0000000000000000a3ce929d0e0e4736"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		// wantTraceID is empty when nothing should be extracted
+		wantTraceID string
+		wantSampled bool
+	}{
+		{name: "single", headers: map[string]string{"b3": testTraceID + "-" + testSpanID + "-1"}, wantTraceID: testTraceID, wantSampled: true},
+		{name: "single without sampling state", headers: map[string]string{"b3": testTraceID + "-" + testSpanID}, wantTraceID: testTraceID},
+		{name: "single debug", headers: map[string]string{"b3": testTraceID + "-" + testSpanID + "-d"}, wantTraceID: testTraceID, wantSampled: true},
+		{name: "single with parent", headers: map[string]string{"b3": testTraceID + "-" + testSpanID + "-1-05e3ac9a4f6e3b90"}, wantTraceID: testTraceID, wantSampled: true},
+		{name: "single 64-bit trace id", headers: map[string]string{"b3": "a3ce929d0e0e4736-" + testSpanID + "-1"}, wantTraceID: padded64, wantSampled: true},
+		{name: "single sampling state only", headers: map[string]string{"b3": "0"}},
+		{name: "single too many parts", headers: map[string]string{"b3": testTraceID + "-" + testSpanID + "-1-05e3ac9a4f6e3b90-1"}},
+		{name: "single malformed span id", headers: map[string]string{"b3": "4bf92f3577b34da6-zz-1"}},
+		{name: "single malformed trace id", headers: map[string]string{"b3": "4bf92f3577b34dzz-" + testSpanID + "-1"}},
+		{name: "single short trace id", headers: map[string]string{"b3": "4bf92f35-" + testSpanID + "-1"}},
+		{name: "single all-zero trace id", headers: map[string]string{"b3": "00000000000000000000000000000000-" + testSpanID + "-1"}},
+		{name: "single all-zero span id", headers: map[string]string{"b3": testTraceID + "-0000000000000000-1"}},
+		{
+			name:        "multi",
+			headers:     map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "1"},
+			wantTraceID: testTraceID, wantSampled: true,
+		},
+		{
+			name:        "multi not sampled",
+			headers:     map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "0"},
+			wantTraceID: testTraceID,
+		},
+		{
+			name:        "multi legacy sampled",
+			headers:     map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "true"},
+			wantTraceID: testTraceID, wantSampled: true,
+		},
+		{
+			name:        "multi debug flag",
+			headers:     map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Flags": "1"},
+			wantTraceID: testTraceID, wantSampled: true,
+		},
+		{
+			name:        "multi 64-bit trace id",
+			headers:     map[string]string{"X-B3-TraceId": "a3ce929d0e0e4736", "X-B3-SpanId": testSpanID, "X-B3-Sampled": "1"},
+			wantTraceID: padded64, wantSampled: true,
+		},
+		{name: "multi without span id", headers: map[string]string{"X-B3-TraceId": testTraceID, "X-B3-Sampled": "1"}},
+		{name: "multi malformed span id", headers: map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": "not-a-span-id!!"}},
+		{name: "multi all-zero trace id", headers: map[string]string{"X-B3-TraceId": "0000000000000000", "X-B3-SpanId": testSpanID}},
+		{
+			name: "single wins over multi",
+			headers: map[string]string{
+				"b3":           testTraceID + "-" + testSpanID + "-1",
+				"X-B3-TraceId": "a3ce929d0e0e4736", "X-B3-SpanId": testSpanID,
+			},
+			wantTraceID: testTraceID, wantSampled: true,
+		},
+		{
+			name:        "malformed single falls back to multi",
+			headers:     map[string]string{"b3": "garbage", "X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "1"},
+			wantTraceID: testTraceID, wantSampled: true,
+		},
+		{name: "no headers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extract(b3Propagator{}, tt.headers)
+			if tt.wantTraceID == "" {
+				if got.IsValid() {
+					t.Errorf("expected nothing extracted, got %+v", got)
+				}
+				return
+			}
+			if want := remoteSpanContext(t, tt.wantTraceID, testSpanID, tt.wantSampled); !got.Equal(want) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestJaegerRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		header := roundTrip(t, jaegerPropagator{}, remoteSpanContext(t, testTraceID, testSpanID, sampled))
+		want := testTraceID + ":" + testSpanID + ":0:0"
+		if sampled {
+			want = testTraceID + ":" + testSpanID + ":0:1"
+		}
+		if got := header.Get(jaegerHeader); got != want {
+			t.Errorf("expected %s: %q, got %q", jaegerHeader, want, got)
+		}
+	}
+}
+
+func TestJaegerExtract(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		// wantTraceID and wantSpanID are empty when nothing should be extracted
+		wantTraceID string
+		wantSpanID  string
+		wantSampled bool
+	}{
+		{name: "sampled", header: testTraceID + ":" + testSpanID + ":0:1", wantTraceID: testTraceID, wantSpanID: testSpanID, wantSampled: true},
+		{name: "not sampled", header: testTraceID + ":" + testSpanID + ":0:0", wantTraceID: testTraceID, wantSpanID: testSpanID},
+		{name: "debug", header: testTraceID + ":" + testSpanID + ":0:2", wantTraceID: testTraceID, wantSpanID: testSpanID, wantSampled: true},
+		{name: "sampled and debug", header: testTraceID + ":" + testSpanID + ":0:3", wantTraceID: testTraceID, wantSpanID: testSpanID, wantSampled: true},
+		{name: "with parent", header: testTraceID + ":" + testSpanID + ":05e3ac9a4f6e3b90:1", wantTraceID: testTraceID, wantSpanID: testSpanID, wantSampled: true},
+		{
+			name: "64-bit trace id", header: "a3ce929d0e0e4736:" + testSpanID + ":0:1",
+			wantTraceID: "0000000000000000a3ce929d0e0e4736", wantSpanID: testSpanID, wantSampled: true,
+		},
+		{
+			name: "leading zeros stripped", header: "3ad:f067aa0ba902b7:0:1",
+			wantTraceID: strings.Repeat("0", 29) + "3ad", wantSpanID: testSpanID, wantSampled: true,
+		},
+		{
+			name: "url encoded", header: testTraceID + "%3A" + testSpanID + "%3A0%3A1",
+			wantTraceID: testTraceID, wantSpanID: testSpanID, wantSampled: true,
+		},
+		{name: "too few parts", header: testTraceID + ":" + testSpanID + ":1"},
+		{name: "too many parts", header: testTraceID + ":" + testSpanID + ":0:1:1"},
+		{name: "trace id too long", header: "1" + testTraceID + ":" + testSpanID + ":0:1"},
+		{name: "span id too long", header: testTraceID + ":1" + testSpanID + ":0:1"},
+		{name: "malformed trace id", header: "not-hex:" + testSpanID + ":0:1"},
+		{name: "malformed flags", header: testTraceID + ":" + testSpanID + ":0:zz"},
+		{name: "all-zero trace id", header: "0:" + testSpanID + ":0:1"},
+		{name: "all-zero span id", header: testTraceID + ":0:0:1"},
+		{name: "empty", header: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extract(jaegerPropagator{}, map[string]string{jaegerHeader: tt.header})
+			if tt.wantTraceID == "" {
+				if got.IsValid() {
+					t.Errorf("expected nothing extracted, got %+v", got)
+				}
+				return
+			}
+			if want := remoteSpanContext(t, tt.wantTraceID, tt.wantSpanID, tt.wantSampled); !got.Equal(want) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestNewPropagator(t *testing.T) {
+	sc := remoteSpanContext(t, testTraceID, testSpanID, true)
+	tests := []struct {
+		names      string
+		wantErr    bool
+		wantFields []string
+	}{
+		{names: DefaultPropagators, wantFields: []string{"traceparent", "tracestate", "baggage"}},
+		{names: " B3 , b3multi,b3", wantFields: []string{"b3", "x-b3-traceid", "x-b3-spanid", "x-b3-sampled"}},
+		{names: "jaeger", wantFields: []string{"uber-trace-id"}},
+		{names: "none"},
+		{names: "none,b3", wantErr: true},
+		{names: "tracecontext,zipkin", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.names, func(t *testing.T) {
+			p, err := NewPropagator(tt.names)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the composite propagator gives its fields in no particular order
+			fields := p.Fields()
+			sort.Strings(fields)
+			sort.Strings(tt.wantFields)
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Fatalf("expected the fields %v, got %v", tt.wantFields, fields)
+			}
+			if len(fields) > 0 {
+				roundTrip(t, p, sc)
+			}
+		})
+	}
+}
+
+func TestLastPropagatorWins(t *testing.T) {
+	p, err := NewPropagator("b3multi,jaeger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := "a3ce929d0e0e47364bf92f3577b34da6"
+	got := extract(p, map[string]string{
+		"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "1",
+		jaegerHeader: other + ":" + testSpanID + ":0:1",
+	})
+	if want := remoteSpanContext(t, other, testSpanID, true); !got.Equal(want) {
+		t.Errorf("expected the trace of the jaeger header, got %+v", got)
+	}
+
+	// the first one is used when the last one finds nothing
+	got = extract(p, map[string]string{"X-B3-TraceId": testTraceID, "X-B3-SpanId": testSpanID, "X-B3-Sampled": "1"})
+	if want := remoteSpanContext(t, testTraceID, testSpanID, true); !got.Equal(want) {
+		t.Errorf("expected the trace of the b3 headers, got %+v", got)
+	}
+}
@@ -0,0 +1,279 @@
+package tracing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The actions of a RedactionRule
+const (
+	// RedactActionRedact replaces the value with RedactedValue (default)
+	RedactActionRedact = "redact"
+	// RedactActionHash replaces the value with its hash, so the spans of the same person can
+	// still be found together without the name being exported
+	RedactActionHash = "hash"
+)
+
+// RedactedValue replaces the redacted values
+const RedactedValue = "[REDACTED]"
+
+// StatusDescriptionKey is the key the rules apply to for the description of the status of the
+// spans, the key it is exported with to Jaeger.
+const StatusDescriptionKey = "otel.status_description"
+
+// RedactionRule redacts the values of the attributes of the spans, of their events and links,
+// and the description of their status (StatusDescriptionKey).
+type RedactionRule struct {
+	// Keys are the attribute keys the rule applies to, all of them if empty
+	Keys []string `json:"keys,omitempty"`
+	// Pattern is a regexp of the parts of the values to redact, the whole value if empty.
+	// If the regexp has groups, only what the first group matched is redacted, e.g.
+	// "/getPerson/([^/?]+)" redacts the name but keeps the route.
+	Pattern string `json:"pattern,omitempty"`
+	// Action is RedactActionRedact or RedactActionHash
+	Action string `json:"action,omitempty"`
+}
+
+// DefaultRedactionRules hash the names, titles and descriptions of the people (attributes,
+// url path and query, errors and SQL statements) and the username of the baggage, and redact
+// the email addresses. They are used
+// when REDACTION_RULES and REDACTION_RULES_FILE are not set.
+var DefaultRedactionRules = []RedactionRule{
+	// the username is only on the spans if BAGGAGE_SPAN_ATTRIBUTES copies it there
+	{Keys: []string{"name", "person.name", "person.Name", "url-values", "username"}, Action: RedactActionHash},
+	// the urls are also in the errors of the failed requests
+	{Keys: []string{"http.target", "http.url", "exception.message", StatusDescriptionKey}, Pattern: `/(?:sayHello|getPerson|people)/([^/?"\s]+)`, Action: RedactActionHash},
+	{Keys: []string{"http.target", "http.url", "exception.message", StatusDescriptionKey}, Pattern: `[?&](?:name|title|description)=([^&"\s]*)`, Action: RedactActionHash},
+	// the errors of the unknown people: person "<name>" not found (queryyer, also in the body
+	// of its 404 answers) and person not found: <names> (main)
+	{Keys: []string{"exception.message", StatusDescriptionKey}, Pattern: `person "((?:[^"\\]|\\.)*)"`, Action: RedactActionHash},
+	{Keys: []string{"exception.message", StatusDescriptionKey}, Pattern: `person not found: (.+)`, Action: RedactActionHash},
+	// the string literals of the SQL statements (e.g. the people inserted by the migrations),
+	// also quoted by the errors of MySQL (Duplicate entry '<name>' ...)
+	{Keys: []string{"db.statement", "exception.message", StatusDescriptionKey}, Pattern: `'((?:[^'\\]|\\.|'')*)'`, Action: RedactActionHash},
+	{Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Action: RedactActionRedact},
+}
+
+// ParseRedactionRules parses the JSON list of RedactionRule.
+func ParseRedactionRules(data []byte) ([]RedactionRule, error) {
+	var rules []RedactionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid redaction rules: %w", err)
+	}
+	return rules, nil
+}
+
+// redactionRulesFromOptions returns the rules of opts: the JSON of RedactionRules, else of
+// the file RedactionRulesFile, else DefaultRedactionRules
+func redactionRulesFromOptions(opts Options) ([]RedactionRule, error) {
+	data := []byte(opts.RedactionRules)
+	if len(data) == 0 && opts.RedactionRulesFile != "" {
+		var err error
+		if data, err = ioutil.ReadFile(opts.RedactionRulesFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return DefaultRedactionRules, nil
+	}
+	return ParseRedactionRules(data)
+}
+
+type compiledRule struct {
+	keys    map[attribute.Key]bool
+	pattern *regexp.Regexp
+	hash    bool
+}
+
+// Redactor applies redaction rules to the spans.
+type Redactor struct {
+	rules   []compiledRule
+	hashKey []byte
+}
+
+// NewRedactor compiles rules. If hashKey is set the hashes are HMACs keyed with it, so the
+// hash of a known name can't be computed by whoever reads the traces.
+func NewRedactor(rules []RedactionRule, hashKey string) (*Redactor, error) {
+	r := &Redactor{hashKey: []byte(hashKey)}
+	for i, rule := range rules {
+		c := compiledRule{}
+		switch rule.Action {
+		case "", RedactActionRedact:
+		case RedactActionHash:
+			c.hash = true
+		default:
+			return nil, fmt.Errorf("redaction rule %d: unknown action %q", i, rule.Action)
+		}
+		if len(rule.Keys) > 0 {
+			c.keys = make(map[attribute.Key]bool, len(rule.Keys))
+			for _, key := range rule.Keys {
+				c.keys[attribute.Key(key)] = true
+			}
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+			}
+			c.pattern = pattern
+		}
+		r.rules = append(r.rules, c)
+	}
+	return r, nil
+}
+
+// Redact returns a copy of span with the values of its attributes, of its events and of its
+// links, and its status description redacted. span is not changed.
+func (r *Redactor) Redact(span *sdktrace.SpanSnapshot) *sdktrace.SpanSnapshot {
+	redacted := *span
+	redacted.Attributes = r.redactAttributes(span.Attributes)
+	if span.StatusMessage != "" {
+		redacted.StatusMessage = r.redactAttribute(attribute.String(StatusDescriptionKey, span.StatusMessage)).Value.Emit()
+	}
+	if span.MessageEvents != nil {
+		redacted.MessageEvents = make([]trace.Event, len(span.MessageEvents))
+		for i, event := range span.MessageEvents {
+			event.Attributes = r.redactAttributes(event.Attributes)
+			redacted.MessageEvents[i] = event
+		}
+	}
+	if span.Links != nil {
+		redacted.Links = make([]trace.Link, len(span.Links))
+		for i, link := range span.Links {
+			link.Attributes = r.redactAttributes(link.Attributes)
+			redacted.Links[i] = link
+		}
+	}
+	return &redacted
+}
+
+func (r *Redactor) redactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if attrs == nil {
+		return nil
+	}
+	redacted := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		redacted[i] = r.redactAttribute(kv)
+	}
+	return redacted
+}
+
+func (r *Redactor) redactAttribute(kv attribute.KeyValue) attribute.KeyValue {
+	for _, rule := range r.rules {
+		if rule.keys != nil && !rule.keys[kv.Key] {
+			continue
+		}
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			kv = kv.Key.String(r.apply(rule, kv.Value.AsString()))
+		case attribute.ARRAY:
+			if values, ok := stringArray(kv.Value); ok {
+				redacted := make([]string, len(values))
+				for i, value := range values {
+					redacted[i] = r.apply(rule, value)
+				}
+				kv = attribute.Array(string(kv.Key), redacted)
+			} else if rule.pattern == nil {
+				kv = kv.Key.String(r.replacement(rule, kv.Value.Emit()))
+			}
+		default:
+			// numbers and booleans can only be redacted as a whole
+			if rule.pattern == nil {
+				kv = kv.Key.String(r.replacement(rule, kv.Value.Emit()))
+			}
+		}
+	}
+	return kv
+}
+
+// stringArray returns the strings of an ARRAY value, false if it holds something else.
+// The values are stored as go arrays ([n]string), not slices.
+func stringArray(value attribute.Value) ([]string, bool) {
+	array := reflect.ValueOf(value.AsArray())
+	if array.Kind() != reflect.Array || array.Type().Elem().Kind() != reflect.String {
+		return nil, false
+	}
+	values := make([]string, array.Len())
+	for i := range values {
+		values[i] = array.Index(i).String()
+	}
+	return values, true
+}
+
+// apply redacts value according to rule
+func (r *Redactor) apply(rule compiledRule, value string) string {
+	if rule.pattern == nil {
+		return r.replacement(rule, value)
+	}
+	return rule.pattern.ReplaceAllStringFunc(value, func(match string) string {
+		if rule.pattern.NumSubexp() == 0 {
+			return r.replacement(rule, match)
+		}
+		// only the first group, the rest of the match is kept
+		loc := rule.pattern.FindStringSubmatchIndex(match)
+		if loc == nil || loc[2] < 0 {
+			return match
+		}
+		return match[:loc[2]] + r.replacement(rule, match[loc[2]:loc[3]]) + match[loc[3]:]
+	})
+}
+
+// replacement is what value is replaced with
+func (r *Redactor) replacement(rule compiledRule, value string) string {
+	if !rule.hash {
+		return RedactedValue
+	}
+	var sum []byte
+	if len(r.hashKey) > 0 {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		sum = mac.Sum(nil)
+	} else {
+		h := sha256.Sum256([]byte(value))
+		sum = h[:]
+	}
+	// 64 bits are plenty to tell the values of a trace apart
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// redactingExporter redacts the spans before handing them to the exporter.
+// The spans can't be changed once they ended (sdktrace.ReadOnlySpan), so the redaction
+// happens on the snapshots the span processors give to the exporters.
+type redactingExporter struct {
+	exporter sdktrace.SpanExporter
+	redactor *Redactor
+}
+
+// NewRedactingExporter wraps exporter so the spans are redacted by redactor before they are
+// exported. With a nil redactor, exporter is returned as is.
+func NewRedactingExporter(exporter sdktrace.SpanExporter, redactor *Redactor) sdktrace.SpanExporter {
+	if redactor == nil {
+		return exporter
+	}
+	return &redactingExporter{exporter: exporter, redactor: redactor}
+}
+
+// ExportSpans implements sdktrace.SpanExporter.
+func (e *redactingExporter) ExportSpans(ctx context.Context, spans []*sdktrace.SpanSnapshot) error {
+	redacted := make([]*sdktrace.SpanSnapshot, len(spans))
+	for i, span := range spans {
+		redacted[i] = e.redactor.Redact(span)
+	}
+	return e.exporter.ExportSpans(ctx, redacted)
+}
+
+// Shutdown implements sdktrace.SpanExporter.
+func (e *redactingExporter) Shutdown(ctx context.Context) error {
+	return e.exporter.Shutdown(ctx)
+}
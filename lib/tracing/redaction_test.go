@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exportRedacted records a span with attrs (and an event with the same attributes) through
+// the redacting exporter, and returns what the exporter received
+func exportRedacted(t *testing.T, rules []RedactionRule, hashKey string, attrs ...attribute.KeyValue) *sdktrace.SpanSnapshot {
+	redactor, err := NewRedactor(rules, hashKey)
+	if err != nil {
+		t.Fatalf("failed to create the redactor: %v", err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(NewRedactingExporter(exporter, redactor)))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "redacted-span", trace.WithAttributes(attrs...))
+	span.AddEvent("event", trace.WithAttributes(attrs...))
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 exported span, got %d", len(spans))
+	}
+	return spans[0]
+}
+
+// attributeValue returns the value of key in attrs, as emitted
+func attributeValue(t *testing.T, attrs []attribute.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	t.Fatalf("attribute %q not found in %v", key, attrs)
+	return ""
+}
+
+func TestRedactionByKey(t *testing.T) {
+	span := exportRedacted(t, []RedactionRule{
+		{Keys: []string{"person.name"}, Action: RedactActionRedact},
+		{Keys: []string{"url-values"}, Action: RedactActionHash},
+		{Keys: []string{"person.age"}},
+	}, "",
+		attribute.String("person.name", "Margo"),
+		attribute.Array("url-values", []string{"Margo", "Ms."}),
+		attribute.Int("person.age", 42),
+		attribute.String("http.method", "GET"),
+	)
+
+	for _, attrs := range [][]attribute.KeyValue{span.Attributes, span.MessageEvents[0].Attributes} {
+		if got := attributeValue(t, attrs, "person.name"); got != RedactedValue {
+			t.Errorf("expected person.name to be redacted, got %q", got)
+		}
+		if got := attributeValue(t, attrs, "person.age"); got != RedactedValue {
+			t.Errorf("expected person.age to be redacted, got %q", got)
+		}
+		if got := attributeValue(t, attrs, "http.method"); got != "GET" {
+			t.Errorf("expected http.method to be kept, got %q", got)
+		}
+		values := attributeValue(t, attrs, "url-values")
+		if strings.Contains(values, "Margo") || strings.Count(values, "sha256:") != 2 {
+			t.Errorf("expected every url value to be hashed, got %q", values)
+		}
+	}
+}
+
+func TestRedactionByPattern(t *testing.T) {
+	span := exportRedacted(t, []RedactionRule{
+		{Keys: []string{"http.target"}, Pattern: `/getPerson/([^/?]+)`, Action: RedactActionHash},
+		{Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	}, "",
+		attribute.String("http.target", "/getPerson/Margo?verbose=1"),
+		attribute.String("exception.message", "cannot mail margo@example.com and eq@example.org"),
+		attribute.String("note", "/getPerson/Margo"),
+	)
+
+	target := attributeValue(t, span.Attributes, "http.target")
+	if !strings.HasPrefix(target, "/getPerson/sha256:") || !strings.HasSuffix(target, "?verbose=1") {
+		t.Errorf("expected only the name of the path to be hashed, got %q", target)
+	}
+	if got := attributeValue(t, span.Attributes, "exception.message"); got != "cannot mail [REDACTED] and [REDACTED]" {
+		t.Errorf("expected the emails to be redacted, got %q", got)
+	}
+	if got := attributeValue(t, span.Attributes, "note"); got != "/getPerson/Margo" {
+		t.Errorf("expected the rule of http.target not to apply to note, got %q", got)
+	}
+}
+
+func TestDefaultRedactionRules(t *testing.T) {
+	tests := []struct {
+		key, value string
+		// want is what is left of value, the hashes replaced with #
+		want string
+	}{
+		{key: "person.name", value: "Margo", want: "#"},
+		{key: "username", value: "alice", want: "#"},
+		{key: "http.url", value: "http://queryyer:8081/getPerson/Margo", want: "http://queryyer:8081/getPerson/#"},
+		{key: "http.target", value: "/getPeople?name=Margo&name=Farhad", want: "/getPeople?name=#&name=#"},
+		{key: "http.target", value: "/people/Margo", want: "/people/#"},
+		{key: "http.url", value: "http://queryyer:8081/getPeople?name=Margo&name=Farhad", want: "http://queryyer:8081/getPeople?name=#&name=#"},
+		{key: "exception.message", value: `person "Margo" not found`, want: `person "#" not found`},
+		{key: "exception.message", value: `person "Ma\"rgo" not found`, want: `person "#" not found`},
+		{key: "exception.message", value: "StatusCode: 404, Body: person \"Margo\" not found\n", want: "StatusCode: 404, Body: person \"#\" not found\n"},
+		{key: "exception.message", value: "person not found: Margo, Farhad", want: "person not found: #"},
+		{key: StatusDescriptionKey, value: `person "Margo" not found`, want: `person "#" not found`},
+		{key: StatusDescriptionKey, value: "person not found: Margo, Farhad", want: "person not found: #"},
+		{
+			key:   "exception.message",
+			value: `Get "http://queryyer:8081/getPerson/Margo": dial tcp: connection refused`,
+			want:  `Get "http://queryyer:8081/getPerson/#": dial tcp: connection refused`,
+		},
+		{key: "exception.message", value: "Error 1062: Duplicate entry 'Margo' for key 'PRIMARY'", want: "Error 1062: Duplicate entry '#' for key '#'"},
+		{
+			key:   "db.statement",
+			value: "INSERT IGNORE INTO people VALUES ('Farhad', 'Dr.', 'Why ... why are you so nice?')",
+			want:  "INSERT IGNORE INTO people VALUES ('#', '#', '#')",
+		},
+		// the seeds of the migrations of queryyer
+		{key: "db.statement", value: "INSERT IGNORE INTO people VALUES ('Margo', 'Ms.', 'Privet!');", want: "INSERT IGNORE INTO people VALUES ('#', '#', '#');"},
+		{key: "db.statement", value: "INSERT IGNORE INTO people VALUES ('Sonos', 'Mr.', 'you are so loud!');", want: "INSERT IGNORE INTO people VALUES ('#', '#', '#');"},
+		{key: "db.statement", value: "SELECT * FROM people WHERE name = 'O''Brien'", want: "SELECT * FROM people WHERE name = '#'"},
+		{key: "db.statement", value: "SELECT * FROM people WHERE name = ?", want: "SELECT * FROM people WHERE name = ?"},
+		{key: "note", value: "person not found: Margo", want: "person not found: Margo"},
+		{key: "note", value: "mail margo@example.com", want: "mail [REDACTED]"},
+	}
+	hashes := regexp.MustCompile(`sha256:[0-9a-f]{16}`)
+	for _, tt := range tests {
+		t.Run(tt.key+" "+tt.value, func(t *testing.T) {
+			span := exportRedacted(t, DefaultRedactionRules, "", attribute.String(tt.key, tt.value))
+			if got := hashes.ReplaceAllString(attributeValue(t, span.Attributes, tt.key), "#"); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactionOfTheStatusDescription(t *testing.T) {
+	redactor, err := NewRedactor(DefaultRedactionRules, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(NewRedactingExporter(exporter, redactor)))
+	_, span := tp.Tracer("test").Start(context.Background(), "failed-span")
+	span.SetStatus(codes.Error, `person "Margo" not found`)
+	span.End()
+
+	got := exporter.GetSpans()[0]
+	if strings.Contains(got.StatusMessage, "Margo") || !strings.HasPrefix(got.StatusMessage, `person "sha256:`) {
+		t.Errorf("expected the name of the status description to be hashed, got %q", got.StatusMessage)
+	}
+	if got.StatusCode != codes.Error {
+		t.Errorf("expected the status code to be kept, got %v", got.StatusCode)
+	}
+}
+
+func TestRedactionHashKey(t *testing.T) {
+	rules := []RedactionRule{{Keys: []string{"name"}, Action: RedactActionHash}}
+	hash := func(hashKey, name string) string {
+		return attributeValue(t, exportRedacted(t, rules, hashKey, attribute.String("name", name)).Attributes, "name")
+	}
+
+	if hash("", "Margo") != hash("", "Margo") {
+		t.Error("expected the same name to have the same hash")
+	}
+	if hash("", "Margo") == hash("", "EQ") {
+		t.Error("expected two names to have different hashes")
+	}
+	if hash("secret", "Margo") == hash("", "Margo") {
+		t.Error("expected the keyed hash to differ from the plain one")
+	}
+}
+
+func TestRedactionKeepsTheOriginalSpan(t *testing.T) {
+	redactor, err := NewRedactor([]RedactionRule{{Keys: []string{"name"}}}, "")
+	if err != nil {
+		t.Fatalf("failed to create the redactor: %v", err)
+	}
+	span := &sdktrace.SpanSnapshot{
+		Attributes:    []attribute.KeyValue{attribute.String("name", "Margo")},
+		MessageEvents: []trace.Event{{Name: "event", Attributes: []attribute.KeyValue{attribute.String("name", "Margo")}}},
+	}
+	redacted := redactor.Redact(span)
+	if got := redacted.Attributes[0].Value.AsString(); got != RedactedValue {
+		t.Errorf("expected the copy to be redacted, got %q", got)
+	}
+	if span.Attributes[0].Value.AsString() != "Margo" || span.MessageEvents[0].Attributes[0].Value.AsString() != "Margo" {
+		t.Error("expected the original span to be left as is")
+	}
+}
+
+func TestRedactionRulesFromJSON(t *testing.T) {
+	rules, err := ParseRedactionRules([]byte(`[{"keys": ["name"], "action": "hash"}, {"pattern": "\\d{4}"}]`))
+	if err != nil {
+		t.Fatalf("failed to parse the rules: %v", err)
+	}
+	span := exportRedacted(t, rules, "", attribute.String("name", "Margo"), attribute.String("card", "card 1234"))
+	if got := attributeValue(t, span.Attributes, "name"); !strings.HasPrefix(got, "sha256:") {
+		t.Errorf("expected name to be hashed, got %q", got)
+	}
+	if got := attributeValue(t, span.Attributes, "card"); got != "card [REDACTED]" {
+		t.Errorf("expected the digits to be redacted, got %q", got)
+	}
+}
+
+func TestRedactionInvalidRules(t *testing.T) {
+	if _, err := NewRedactor([]RedactionRule{{Action: "shred"}}, ""); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+	if _, err := NewRedactor([]RedactionRule{{Pattern: "("}}, ""); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if _, err := ParseRedactionRules([]byte(`{"keys": "name"}`)); err == nil {
+		t.Error("expected an error for invalid JSON rules")
+	}
+}
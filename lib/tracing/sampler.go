@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The samplers accepted by Options.Sampler (OTEL_TRACES_SAMPLER).
+// Every one of them can also be prefixed with "parentbased_", then the decision of the
+// parent span is respected and the sampler is only used for the root spans.
+const (
+	SamplerAlwaysOn     = "always_on"
+	SamplerAlwaysOff    = "always_off"
+	SamplerTraceIDRatio = "traceidratio" // arg: ratio between 0 and 1
+	SamplerRateLimited  = "ratelimited"  // arg: number of traces per second
+	SamplerRules        = "rules"        // arg: per-route rules, e.g. "/sayHello/=0.5,/getPerson/=10/s,*=0.1"
+
+	parentBasedPrefix = "parentbased_"
+)
+
+// The resource attributes recording which sampler the service is running with
+const (
+	samplerTypeKey  = attribute.Key("sampler.type")
+	samplerParamKey = attribute.Key("sampler.param")
+)
+
+// newSampler builds the sampler selected by name, configured by arg.
+func newSampler(name, arg string) (sdktrace.Sampler, error) {
+	if strings.HasPrefix(name, parentBasedPrefix) {
+		root, err := newSampler(strings.TrimPrefix(name, parentBasedPrefix), arg)
+		if err != nil {
+			return nil, err
+		}
+		return sdktrace.ParentBased(root), nil
+	}
+
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		ratio := 1.0
+		if arg != "" {
+			var err error
+			if ratio, err = strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("invalid ratio %q for the %s sampler: %w", arg, name, err)
+			}
+		}
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case SamplerRateLimited:
+		perSecond := 1.0
+		if arg != "" {
+			var err error
+			if perSecond, err = strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("invalid rate %q for the %s sampler: %w", arg, name, err)
+			}
+		}
+		return RateLimitingSampler(perSecond), nil
+	case SamplerRules:
+		return parseRules(arg)
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", name)
+	}
+}
+
+// samplerAttributes records the chosen sampler in the resource
+func samplerAttributes(name, arg string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{samplerTypeKey.String(name)}
+	if arg != "" {
+		attrs = append(attrs, samplerParamKey.String(arg))
+	}
+	return attrs
+}
+
+type rateLimitingSampler struct {
+	mu          sync.Mutex
+	perSecond   float64
+	balance     float64
+	lastTick    time.Time
+	description string
+}
+
+// RateLimitingSampler samples at most perSecond traces every second (token bucket),
+// the rest of them are dropped. Like TraceIDRatioBased it should be used as the root
+// of a ParentBased sampler, otherwise traces can be cut in the middle.
+func RateLimitingSampler(perSecond float64) sdktrace.Sampler {
+	if perSecond < 0 {
+		perSecond = 0
+	}
+	return &rateLimitingSampler{
+		perSecond: perSecond,
+		// allow one full second worth of traces at start
+		balance:     math.Max(perSecond, 1),
+		lastTick:    time.Now(),
+		description: fmt.Sprintf("RateLimitingSampler{%g}", perSecond),
+	}
+}
+
+func (rs *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	if rs.take() {
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: psc.TraceState()}
+	}
+	return sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: psc.TraceState()}
+}
+
+// take refills the bucket with the time passed since the last call and takes one trace out of it
+func (rs *rateLimitingSampler) take() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(rs.lastTick).Seconds()
+	rs.lastTick = now
+	rs.balance = math.Min(rs.balance+elapsed*rs.perSecond, math.Max(rs.perSecond, 1))
+	if rs.balance < 1 {
+		return false
+	}
+	rs.balance--
+	return true
+}
+
+func (rs *rateLimitingSampler) Description() string {
+	return rs.description
+}
+
+// samplingRule applies sampler to the spans of a route
+type samplingRule struct {
+	route   string
+	sampler sdktrace.Sampler
+}
+
+type ruleBasedSampler struct {
+	rules       []samplingRule
+	fallback    sdktrace.Sampler
+	description string
+}
+
+// parseRules parses rules like "/sayHello/=0.5,/getPerson/=10/s,*=0.1".
+// The value of a rule is either a ratio or a rate ("<n>/s"), "*" sets the sampler used
+// for the spans that match no route (default always on).
+func parseRules(arg string) (sdktrace.Sampler, error) {
+	rs := &ruleBasedSampler{fallback: sdktrace.AlwaysSample()}
+	for _, rule := range strings.Split(arg, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sampling rule %q, expected route=value", rule)
+		}
+		route, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		var sampler sdktrace.Sampler
+		if strings.HasSuffix(value, "/s") {
+			perSecond, err := strconv.ParseFloat(strings.TrimSuffix(value, "/s"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate in sampling rule %q: %w", rule, err)
+			}
+			sampler = RateLimitingSampler(perSecond)
+		} else {
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ratio in sampling rule %q: %w", rule, err)
+			}
+			sampler = sdktrace.TraceIDRatioBased(ratio)
+		}
+
+		if route == "*" {
+			rs.fallback = sampler
+			continue
+		}
+		rs.rules = append(rs.rules, samplingRule{route: route, sampler: sampler})
+	}
+
+	descriptions := make([]string, 0, len(rs.rules)+1)
+	for _, rule := range rs.rules {
+		descriptions = append(descriptions, rule.route+":"+rule.sampler.Description())
+	}
+	descriptions = append(descriptions, "*:"+rs.fallback.Description())
+	rs.description = fmt.Sprintf("RuleBasedSampler{%s}", strings.Join(descriptions, ","))
+	return rs, nil
+}
+
+// ShouldSample uses the first rule whose route is a prefix of the span name or of its
+// http.target/http.route attribute (that's what otelhttp sets on the server spans)
+func (rs *ruleBasedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, rule := range rs.rules {
+		if matchRoute(rule.route, p) {
+			return rule.sampler.ShouldSample(p)
+		}
+	}
+	return rs.fallback.ShouldSample(p)
+}
+
+func (rs *ruleBasedSampler) Description() string {
+	return rs.description
+}
+
+func matchRoute(route string, p sdktrace.SamplingParameters) bool {
+	if strings.HasPrefix(p.Name, route) {
+		return true
+	}
+	for _, attr := range p.Attributes {
+		if attr.Key == semconv.HTTPTargetKey || attr.Key == semconv.HTTPRouteKey {
+			if strings.HasPrefix(attr.Value.AsString(), route) {
+				return true
+			}
+		}
+	}
+	return false
+}
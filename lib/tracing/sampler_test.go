@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// samplingParameters are the parameters of a span named name, the child of parent if valid
+func samplingParameters(t *testing.T, parent trace.SpanContext, name string, attrs ...attribute.KeyValue) sdktrace.SamplingParameters {
+	traceID, err := trace.TraceIDFromHex(testTraceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.IsValid() {
+		traceID = parent.TraceID()
+	}
+	return sdktrace.SamplingParameters{
+		ParentContext: trace.ContextWithRemoteSpanContext(context.Background(), parent),
+		TraceID:       traceID,
+		Name:          name,
+		Attributes:    attrs,
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		name, arg string
+		// want is the beginning of the description of the sampler
+		want string
+	}{
+		{name: SamplerAlwaysOn, want: "AlwaysOnSampler"},
+		{name: SamplerAlwaysOff, want: "AlwaysOffSampler"},
+		// a ratio of 1 is always on
+		{name: SamplerTraceIDRatio, want: "AlwaysOnSampler"},
+		{name: SamplerTraceIDRatio, arg: "0.25", want: "TraceIDRatioBased{0.25}"},
+		{name: SamplerRateLimited, want: "RateLimitingSampler{1}"},
+		{name: SamplerRateLimited, arg: "10", want: "RateLimitingSampler{10}"},
+		{name: SamplerRateLimited, arg: "-1", want: "RateLimitingSampler{0}"},
+		{name: SamplerRules, want: "RuleBasedSampler{*:AlwaysOnSampler}"},
+		{
+			name: SamplerRules,
+			arg:  " /sayHello/ = 0.5 , /getPerson/=10/s,,*=0.1",
+			want: "RuleBasedSampler{/sayHello/:TraceIDRatioBased{0.5},/getPerson/:RateLimitingSampler{10},*:TraceIDRatioBased{0.1}}",
+		},
+		{name: "parentbased_" + SamplerAlwaysOff, want: "ParentBased{root:AlwaysOffSampler,"},
+		{name: "parentbased_" + SamplerTraceIDRatio, arg: "0.5", want: "ParentBased{root:TraceIDRatioBased{0.5},"},
+		{name: "parentbased_" + SamplerRules, arg: "*=2/s", want: "ParentBased{root:RuleBasedSampler{*:RateLimitingSampler{2}},"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.arg, func(t *testing.T) {
+			sampler, err := newSampler(tt.name, tt.arg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sampler.Description(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewSamplerErrors(t *testing.T) {
+	tests := []struct {
+		name, arg string
+	}{
+		{name: "sometimes"},
+		{name: ""},
+		{name: "parentbased_sometimes"},
+		{name: "parentbased_parentbased_"},
+		{name: SamplerTraceIDRatio, arg: "half"},
+		{name: "parentbased_" + SamplerTraceIDRatio, arg: "half"},
+		{name: SamplerRateLimited, arg: "fast"},
+		{name: SamplerRules, arg: "/sayHello/"},
+		{name: SamplerRules, arg: "/sayHello/=0.5,*"},
+		{name: SamplerRules, arg: "/sayHello/=fast/s"},
+		{name: SamplerRules, arg: "/sayHello/=half"},
+		{name: SamplerRules, arg: "/sayHello/=10/m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.arg, func(t *testing.T) {
+			if sampler, err := newSampler(tt.name, tt.arg); err == nil {
+				t.Errorf("expected an error, got %s", sampler.Description())
+			}
+		})
+	}
+}
+
+func TestSamplingDecisions(t *testing.T) {
+	sampled := remoteSpanContext(t, testTraceID, testSpanID, true)
+	notSampled := remoteSpanContext(t, testTraceID, testSpanID, false)
+	tests := []struct {
+		name, arg string
+		parent    trace.SpanContext
+		want      sdktrace.SamplingDecision
+	}{
+		{name: SamplerAlwaysOn, want: sdktrace.RecordAndSample},
+		{name: SamplerAlwaysOn, parent: notSampled, want: sdktrace.RecordAndSample},
+		{name: SamplerAlwaysOff, want: sdktrace.Drop},
+		{name: SamplerAlwaysOff, parent: sampled, want: sdktrace.Drop},
+		{name: SamplerTraceIDRatio, arg: "1", want: sdktrace.RecordAndSample},
+		{name: SamplerTraceIDRatio, arg: "0", want: sdktrace.Drop},
+		{name: SamplerRateLimited, arg: "10", want: sdktrace.RecordAndSample},
+		{name: SamplerRules, arg: "*=0", want: sdktrace.Drop},
+		{name: "parentbased_" + SamplerAlwaysOff, want: sdktrace.Drop},
+		{name: "parentbased_" + SamplerAlwaysOff, parent: sampled, want: sdktrace.RecordAndSample},
+		{name: "parentbased_" + SamplerAlwaysOn, want: sdktrace.RecordAndSample},
+		{name: "parentbased_" + SamplerAlwaysOn, parent: notSampled, want: sdktrace.Drop},
+		{name: "parentbased_" + SamplerTraceIDRatio, arg: "0", parent: sampled, want: sdktrace.RecordAndSample},
+		{name: "parentbased_" + SamplerRules, arg: "*=1", parent: notSampled, want: sdktrace.Drop},
+	}
+	for _, tt := range tests {
+		parent := "root"
+		if tt.parent.IsValid() {
+			parent = "sampled parent"
+			if !tt.parent.IsSampled() {
+				parent = "not sampled parent"
+			}
+		}
+		t.Run(tt.name+" "+tt.arg+" "+parent, func(t *testing.T) {
+			sampler, err := newSampler(tt.name, tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sampler.ShouldSample(samplingParameters(t, tt.parent, "span")).Decision; got != tt.want {
+				t.Errorf("expected decision %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	rs := RateLimitingSampler(2).(*rateLimitingSampler)
+	sample := func() bool {
+		return rs.ShouldSample(samplingParameters(t, trace.SpanContext{}, "span")).Decision == sdktrace.RecordAndSample
+	}
+
+	// one second worth of traces at start, then the bucket is empty
+	if !sample() || !sample() {
+		t.Fatal("expected the first 2 traces to be sampled")
+	}
+	if sample() {
+		t.Fatal("expected the 3rd trace of the second to be dropped")
+	}
+
+	// half a second later, the bucket holds one more trace
+	rs.mu.Lock()
+	rs.lastTick = rs.lastTick.Add(-500 * time.Millisecond)
+	rs.mu.Unlock()
+	if !sample() || sample() {
+		t.Error("expected a single trace to be sampled after half a second")
+	}
+
+	// the bucket holds no more than a second worth of traces, however long the wait
+	rs.mu.Lock()
+	rs.lastTick = rs.lastTick.Add(-time.Minute)
+	rs.mu.Unlock()
+	var n int
+	for i := 0; i < 10; i++ {
+		if sample() {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("expected 2 traces to be sampled after a minute, got %d", n)
+	}
+}
+
+func TestRateLimitingSamplerBelowOnePerSecond(t *testing.T) {
+	rs := RateLimitingSampler(0.5).(*rateLimitingSampler)
+	sample := func() bool {
+		return rs.ShouldSample(samplingParameters(t, trace.SpanContext{}, "span")).Decision == sdktrace.RecordAndSample
+	}
+	if !sample() || sample() {
+		t.Fatal("expected a single trace to be sampled at start")
+	}
+	rs.mu.Lock()
+	rs.lastTick = rs.lastTick.Add(-time.Second)
+	rs.mu.Unlock()
+	if sample() {
+		t.Error("expected no trace to be sampled before 2 seconds")
+	}
+	rs.mu.Lock()
+	rs.lastTick = rs.lastTick.Add(-time.Second)
+	rs.mu.Unlock()
+	if !sample() {
+		t.Error("expected a trace to be sampled after 2 seconds")
+	}
+}
+
+func TestRuleBasedSampler(t *testing.T) {
+	sampler, err := parseRules("/sayHello/admin=0,/sayHello/=1,/getPerson/=0,*=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		span  string
+		attrs []attribute.KeyValue
+		want  sdktrace.SamplingDecision
+	}{
+		{name: "span name", span: "/sayHello/Margo", want: sdktrace.RecordAndSample},
+		{name: "first rule wins", span: "/sayHello/admin", want: sdktrace.Drop},
+		{name: "http.target", span: "HTTP GET", attrs: []attribute.KeyValue{semconv.HTTPTargetKey.String("/sayHello/Margo")}, want: sdktrace.RecordAndSample},
+		{name: "http.route", span: "HTTP GET", attrs: []attribute.KeyValue{semconv.HTTPRouteKey.String("/sayHello/")}, want: sdktrace.RecordAndSample},
+		{name: "dropped route", span: "HTTP GET", attrs: []attribute.KeyValue{semconv.HTTPTargetKey.String("/getPerson/Margo")}, want: sdktrace.Drop},
+		{name: "other attribute", span: "HTTP GET", attrs: []attribute.KeyValue{semconv.HTTPURLKey.String("/sayHello/Margo")}, want: sdktrace.Drop},
+		{name: "no route", span: "/formatGreeting", want: sdktrace.Drop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampler.ShouldSample(samplingParameters(t, trace.SpanContext{}, tt.span, tt.attrs...)).Decision; got != tt.want {
+				t.Errorf("expected decision %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
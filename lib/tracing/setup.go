@@ -0,0 +1,291 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// The values accepted by Options.Exporter (TRACING_OPTION)
+const (
+	// ExporterOTelCollector exports traces and metrics over OTLP to the otel agent/collector
+	ExporterOTelCollector = "otel-collector"
+	// ExporterJaegerCollector exports traces straightly to the jaeger agent
+	ExporterJaegerCollector = "jaeger-collector"
+	// ExporterStdout prints the finished spans to stdout as pretty JSON, no collector needed
+	ExporterStdout = "stdout"
+	// ExporterFilePrefix followed by a path (e.g. file:/tmp/spans.json) appends the finished
+	// spans to that file as newline-delimited JSON
+	ExporterFilePrefix = "file:"
+)
+
+// Options holds everything Setup needs to build the telemetry pipeline of a service.
+type Options struct {
+	// ServiceName, Environment and ID are recorded in the Resource of every span
+	ServiceName string
+	Environment string
+	ID          int64
+
+	// Exporter selects where the telemetry is sent to (ExporterOTelCollector, ExporterJaegerCollector,
+	// ExporterStdout or ExporterFilePrefix+path)
+	Exporter string
+
+	// Sampler decides which traces are recorded (see the Sampler* constants), SamplerArg configures it
+	Sampler    string
+	SamplerArg string
+
+	// OTLP is where the telemetry is sent to when Exporter is ExporterOTelCollector
+	OTLP OTLPConfig
+
+	// CollectPeriod is how often the metrics are collected and pushed
+	CollectPeriod time.Duration
+
+	// PrometheusAddr is the address of the admin server exposing the metrics on /metrics
+	// for prometheus to scrape (e.g. ":9464"), disabled if empty
+	PrometheusAddr string
+
+	// Jaeger is where the spans are sent to when Exporter is ExporterJaegerCollector
+	Jaeger JaegerEndpoint
+
+	// Propagators is the comma separated list of the formats the trace context and the
+	// baggage are propagated with (see the Propagator* constants), the same for all the
+	// services so they join the same traces
+	Propagators string
+
+	// Baggage filters the inbound baggage and tells which entries are copied onto the spans
+	Baggage BaggagePolicy
+
+	// RedactionRules is the JSON list of the RedactionRule applied to the spans before they
+	// are exported, or RedactionRulesFile the file holding it (DefaultRedactionRules if
+	// neither is set, "[]" disables the redaction)
+	RedactionRules     string
+	RedactionRulesFile string
+	// RedactionHashKey keys the hashes of the redaction rules (HMAC), if set
+	RedactionHashKey string
+}
+
+// ShutdownFunc flushes whatever telemetry is still buffered and stops the providers.
+type ShutdownFunc func(ctx context.Context) error
+
+// shutdownAll runs the steps in order, all of them even if some fail, and returns their
+// errors combined (the first one can be unwrapped)
+func shutdownAll(ctx context.Context, steps ...ShutdownFunc) error {
+	var errs []error
+	for _, step := range steps {
+		if err := step(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errs[0]
+	for _, other := range errs[1:] {
+		err = fmt.Errorf("%w; %v", err, other)
+	}
+	return err
+}
+
+// OptionsFromEnv returns the Options of a service based on the environment variables.
+// service, environment and id are used for the resource, OTEL_SERVICE_NAME can override the service name.
+func OptionsFromEnv(service, environment string, id int64) Options {
+	return Options{
+		ServiceName:    env.Get("OTEL_SERVICE_NAME", service),
+		Environment:    environment,
+		ID:             id,
+		Exporter:       env.Get("TRACING_OPTION", ExporterOTelCollector),
+		Sampler:        env.Get("OTEL_TRACES_SAMPLER", SamplerAlwaysOn),
+		SamplerArg:     os.Getenv("OTEL_TRACES_SAMPLER_ARG"),
+		OTLP:           OTLPConfigFromEnv(),
+		CollectPeriod:  collectPeriodFromEnv(),
+		PrometheusAddr: os.Getenv("PROMETHEUS_ADDR"),
+		Jaeger:         JaegerEndpointFromEnv(),
+		Propagators:    env.Get("OTEL_PROPAGATORS", DefaultPropagators),
+		Baggage:        BaggagePolicyFromEnv(),
+
+		RedactionRules:     os.Getenv("REDACTION_RULES"),
+		RedactionRulesFile: os.Getenv("REDACTION_RULES_FILE"),
+		RedactionHashKey:   os.Getenv("REDACTION_HASH_KEY"),
+	}
+}
+
+// Setup builds the tracer provider, meter provider, propagator and resource of a service
+// and registers them as the globals. The returned ShutdownFunc should be called before the
+// application exits, so the last spans are not lost.
+func Setup(ctx context.Context, opts Options) (ShutdownFunc, error) {
+	sampler, err := newSampler(opts.Sampler, opts.SamplerArg)
+	if err != nil {
+		return nil, err
+	}
+	propagator, err := NewPropagator(opts.Propagators)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := redactionRulesFromOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := NewRedactor(rules, opts.RedactionHashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	tracesShutdown, metricExporter, err := setupTraces(ctx, opts, res, sampler, newBaggageSpanProcessor(opts.Baggage.SpanAttributeKeys), redactor)
+	if err != nil {
+		return nil, err
+	}
+	metricsShutdown, err := setupMetrics(ctx, opts, res, metricExporter)
+	if err != nil {
+		_ = tracesShutdown(ctx)
+		return nil, err
+	}
+	// whatever the exporter, so the services (and the client) understand each other
+	otel.SetTextMapPropagator(propagator)
+	SetBaggagePolicy(opts.Baggage)
+
+	return func(ctx context.Context) error {
+		// metrics first, the controller pushes one last collection through the exporter
+		// which is shut down along with the tracer provider. The spans are flushed even if
+		// that last push fails (e.g. the collector is down).
+		return shutdownAll(ctx, metricsShutdown, tracesShutdown)
+	}, nil
+}
+
+// setupTraces builds the tracer provider of the selected exporter. It also returns the exporter
+// the metrics should be pushed to, if that exporter supports them.
+// processor is added to the tracer provider if not nil, the spans are exported once redacted by redactor.
+func setupTraces(ctx context.Context, opts Options, res *resource.Resource, sampler sdktrace.Sampler, processor sdktrace.SpanProcessor, redactor *Redactor) (ShutdownFunc, export.Exporter, error) {
+	switch opts.Exporter {
+	case ExporterOTelCollector:
+		return setupOTel(ctx, opts, res, sampler, processor, redactor)
+	case ExporterJaegerCollector:
+		shutdown, err := setupJaeger(opts, res, sampler, processor, redactor)
+		return shutdown, nil, err
+	case ExporterStdout:
+		shutdown, err := setupJSON(newStdoutExporter(), res, sampler, processor, redactor)
+		return shutdown, nil, err
+	default:
+		if strings.HasPrefix(opts.Exporter, ExporterFilePrefix) {
+			exporter, err := newFileExporter(strings.TrimPrefix(opts.Exporter, ExporterFilePrefix))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open the span file: %w", err)
+			}
+			shutdown, err := setupJSON(exporter, res, sampler, processor, redactor)
+			return shutdown, nil, err
+		}
+		return nil, nil, fmt.Errorf("unknown tracing option %q", opts.Exporter)
+	}
+}
+
+// setupOTel exports both traces and metrics to the otel agent/collector
+func setupOTel(ctx context.Context, opts Options, res *resource.Resource, sampler sdktrace.Sampler, processor sdktrace.SpanProcessor, redactor *Redactor) (ShutdownFunc, export.Exporter, error) {
+	// Create new OTLP Exporter, over grpc or http (OTEL_EXPORTER_OTLP_PROTOCOL)
+	driver, err := newOTLPDriver(opts.OTLP)
+	if err != nil {
+		return nil, nil, err
+	}
+	exporter, err := otlp.NewExporter(ctx, driver)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create new OTLP exporter: %w", err)
+	}
+
+	// if you want to have specific kind of trace ID,
+	// for instance if you want to set up the otel collector to export traces to both aws cloudwatch
+	// and another jaeger instance
+	idg := xray.NewIDGenerator()
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(res),
+		sdktrace.WithSyncer(NewRedactingExporter(exporter, redactor)),
+		sdktrace.WithIDGenerator(idg),
+	)
+
+	registerProcessor(tp, processor)
+	otel.SetTracerProvider(tp)
+
+	// the metrics are pushed to the agent along with the traces (the metrics pipeline is enabled in the agent config)
+	// Shutting down the tracer provider also shuts the exporter down
+	return tp.Shutdown, exporter, nil
+}
+
+// setupJaeger exports the traces to the jaeger agent or collector, the metrics can only be pulled by prometheus in this mode
+func setupJaeger(opts Options, res *resource.Resource, sampler sdktrace.Sampler, processor sdktrace.SpanProcessor, redactor *Redactor) (ShutdownFunc, error) {
+	tp, err := newJaegerTracerProvider(opts.Jaeger, res, sampler, redactor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register our TracerProvider as the global so any imported
+	// instrumentation in the future will default to using it.
+	registerProcessor(tp, processor)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// setupJSON writes the spans locally (stdout or file) for debugging without any collector,
+// the metrics can only be pulled by prometheus in this mode
+func setupJSON(exporter *jsonExporter, res *resource.Resource, sampler sdktrace.Sampler, processor sdktrace.SpanProcessor, redactor *Redactor) (ShutdownFunc, error) {
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(res),
+		// spans are written as soon as they end, so we see them right away
+		sdktrace.WithSyncer(NewRedactingExporter(exporter, redactor)),
+	)
+
+	registerProcessor(tp, processor)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// registerProcessor adds processor (e.g. the baggage one) to tp, if not nil
+func registerProcessor(tp *sdktrace.TracerProvider, processor sdktrace.SpanProcessor) {
+	if processor != nil {
+		tp.RegisterSpanProcessor(processor)
+	}
+}
+
+// newResource records information about the application in a Resource
+func newResource(ctx context.Context, opts Options) (*resource.Resource, error) {
+	return resource.New(ctx,
+		resource.WithAttributes(
+			// the service name used to display traces in backends
+			semconv.ServiceNameKey.String(opts.ServiceName),
+			attribute.String("environment", opts.Environment),
+			attribute.Int64("ID", opts.ID),
+		),
+		// so we know which part of the traffic ended up in the backend
+		resource.WithAttributes(samplerAttributes(opts.Sampler, opts.SamplerArg)...),
+	)
+}
+
+// collectPeriodFromEnv reads OTEL_METRIC_EXPORT_INTERVAL, in milliseconds like the spec
+func collectPeriodFromEnv() time.Duration {
+	if interval := os.Getenv("OTEL_METRIC_EXPORT_INTERVAL"); interval != "" {
+		if ms, err := strconv.Atoi(interval); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return DefaultCollectPeriod
+}
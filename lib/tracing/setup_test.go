@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestShutdownRunsEveryStep(t *testing.T) {
+	errMetrics := errors.New("collector unreachable")
+	var ran []string
+	step := func(name string, err error) ShutdownFunc {
+		return func(context.Context) error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+
+	err := shutdownAll(context.Background(),
+		step("metrics", errMetrics), step("traces", nil), step("admin", errors.New("admin server stuck")))
+	if strings.Join(ran, ",") != "metrics,traces,admin" {
+		t.Errorf("expected every step to run in order, ran %v", ran)
+	}
+	if !errors.Is(err, errMetrics) || !strings.Contains(err.Error(), "admin server stuck") {
+		t.Errorf("expected both errors, got %v", err)
+	}
+	if err := shutdownAll(context.Background(), step("traces", nil)); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -7,34 +7,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
-	"time"
+	"sync"
 
+	"medium-opentelemetry-poc/lib/env"
+	"medium-opentelemetry-poc/lib/fault"
+	"medium-opentelemetry-poc/lib/health"
+	"medium-opentelemetry-poc/lib/httpclient"
 	"medium-opentelemetry-poc/lib/model"
+	"medium-opentelemetry-poc/lib/server"
 	"medium-opentelemetry-poc/lib/tracing"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
-	"go.opentelemetry.io/otel/propagation"
-	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
-	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
-	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	"go.opentelemetry.io/otel/semconv"
 	"go.opentelemetry.io/otel/trace"
-
-	"go.opentelemetry.io/contrib/propagators/aws/xray"
 )
 
 const (
@@ -45,38 +35,81 @@ const (
 
 var tracer = otel.Tracer("main-service")
 
-func main() {
+// The clients of the dependencies, shared by all the requests. Each one has its own timeout,
+// retries and circuit breaker (QUERYYER_* and FORMATTER_*, see httpclient.ConfigFromEnv)
+var (
+	queryyerClient  = httpclient.New("queryyer", httpclient.ConfigFromEnv("QUERYYER"))
+	formatterClient = httpclient.New("formatter", httpclient.ConfigFromEnv("FORMATTER"))
+)
 
-	// We have two configuration, either using otel collector as agent/collector
-	// or using the jaeger agent/collector, to export traces
-	tracingOption := getenv("TRACING_OPTION", "otel-collector")
+// The policies accepted by MISSING_PERSON_POLICY, what to do when queryyer doesn't know the person
+const (
+	// missingPersonFallback greets the person by name only (default)
+	missingPersonFallback = "fallback"
+	// missingPersonError answers 404 to /sayHello/
+	missingPersonError = "error"
+)
 
-	if tracingOption == "otel-collector" {
-		initProvider()
-	} else if tracingOption == "jaeger-collector" {
-		initProviderJaeger()
-	}
+// errPersonNotFound is returned by getPerson for the unknown people with the error policy
+var errPersonNotFound = errors.New("person not found")
+
+// StatusError is returned by DoWithClient when the response is not 200 OK.
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("StatusCode: %d, Body: %s", e.StatusCode, e.Body)
+}
+
+// isStatus tells whether err is a StatusError with the given status code
+func isStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+func main() {
 
 	// Important to defer the cancel
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Cleanly shutdown and flush telemetry when the application exits.
-	defer func(ctx context.Context) {
-		// Do not make the application hang when it is shutdown.
-		ctx, cancel = context.WithTimeout(ctx, time.Second*5)
-		defer cancel()
-	}(ctx)
+	// We have two configuration, either using otel collector as agent/collector
+	// or using the jaeger agent/collector, to export traces (TRACING_OPTION)
+	opts := tracing.OptionsFromEnv(service, environment, id)
+	shutdown, err := tracing.Setup(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// errors and latency injected on purpose, none unless configured (FAULT_INJECTION_*)
+	faults, err := fault.InjectorFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// calling Handle function, which is wrapped for tracing
-	wrappedHandler := otelhttp.NewHandler(http.HandlerFunc(handleSayHello), "/sayHello/")
+	// calling Handle function, which is wrapped for tracing and the RED metrics
+	wrappedHandler := tracing.NewHandler(faults.Wrap(http.HandlerFunc(handleSayHello), "/sayHello/"), "/sayHello/")
 	http.Handle("/sayHello/", wrappedHandler)
 	// unwrapped HandleFunc is like below
 	// http.HandleFunc("/sayHello/", handleSayHello)
-	listeningPort := getenv("PORT", ":8080")
-	log.Print("Listening on http://localhost:8080/")
-	log.Fatal(http.ListenAndServe(listeningPort, nil))
+	// /healthz and /readyz, not traced. Ready when queryyer and formatter are alive
+	checker := &health.Checker{}
+	checker.Add("queryyer", health.HTTPCheck(healthURL(env.Get("QUERYYER_URL", "http://localhost:8081/getPerson/"))))
+	checker.Add("formatter", health.HTTPCheck(healthURL(env.Get("FORMATTER_URL", "http://localhost:8082/formatGreeting?"))))
+	if check := tracing.ExporterCheck(opts); check != nil {
+		checker.AddOptional("exporter", check)
+	}
+	health.Register(http.DefaultServeMux, checker)
+
+	listeningPort := env.Get("PORT", ":8080")
+	srv := &http.Server{Addr: listeningPort}
 
+	// Serve until SIGTERM, then drain the requests and flush the telemetry before exiting
+	if err := server.Run(ctx, srv, server.ShutdownTimeoutFromEnv(), shutdown); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func handleSayHello(w http.ResponseWriter, r *http.Request) {
@@ -94,11 +127,8 @@ func handleSayHello(w http.ResponseWriter, r *http.Request) {
 	defer span.End()
 	// Adding attributes (tags)
 	span.SetAttributes(attribute.Key("MoreInfo").String("ca va?"))
-	//simulating an error
-	span.RecordError(errors.New("Opps"))
-	// For very sensetive error, we can change status to error
-	// So in the ui we will have visually informed
-	span.SetStatus(codes.Error, "Oh No!")
+	// errors are simulated by the fault injection (lib/fault), not here: a span is marked
+	// as failed (span.SetStatus(codes.Error, ...)) only when something really went wrong
 
 	// we can also add event (added to logging part)
 	span.AddEvent("example Event", trace.WithAttributes(
@@ -106,7 +136,24 @@ func handleSayHello(w http.ResponseWriter, r *http.Request) {
 	))
 
 	name := strings.TrimPrefix(r.URL.Path, "/sayHello/")
-	greeting, err := SayHello(ctx, name)
+	var greeting string
+	var err error
+	if names := r.URL.Query()["name"]; name == "" && len(names) > 0 {
+		// batch: /sayHello/?name=EQ&name=Margo, one greeting per line
+		greeting, err = SayHelloAll(ctx, names)
+	} else {
+		greeting, err = SayHello(ctx, name)
+	}
+	if errors.Is(err, errPersonNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, httpclient.ErrCircuitOpen) {
+		// a dependency is down, we don't even try until its breaker closes again
+		span.SetAttributes(attribute.Bool("error", true))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		span.SetAttributes(attribute.Bool("error", true))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -130,9 +177,58 @@ func SayHello(ctx context.Context, name string) (string, error) {
 	return formatGreeting(ctx, person)
 }
 
+// maxConcurrentGreetings limits the greetings SayHelloAll formats at once
+const maxConcurrentGreetings = 10
+
+// SayHelloAll creates the greetings of the named people, one per line.
+// The people are looked up at once (one request to queryyer), then their greetings are
+// formatted concurrently (fan-out to formatter).
+func SayHelloAll(ctx context.Context, names []string) (string, error) {
+	ctx, span := tracer.Start(ctx, "main_SayHelloAll_function")
+	span.SetAttributes(attribute.Int("batch.size", len(names)))
+	defer span.End()
+
+	people, err := getPeople(ctx, names)
+	if err != nil {
+		return "", err
+	}
+
+	// the first failure cancels the other greetings
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	greetings := make([]string, len(people))
+	errs := make([]error, len(people))
+	slots := make(chan struct{}, maxConcurrentGreetings)
+	var wg sync.WaitGroup
+	for i, person := range people {
+		wg.Add(1)
+		go func(i int, person *model.Person) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if greetings[i], errs[i] = formatGreeting(ctx, person); errs[i] != nil {
+				cancel()
+			}
+		}(i, person)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		// the first one which is not only the consequence of the cancellation
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return "", err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(greetings, "\n"), nil
+}
+
 func getPerson(ctx context.Context, name string) (*model.Person, error) {
-	queryyerURL := getenv("QUERYYER_URL", "http://localhost:8081/getPerson/")
-	// queryyerURL_java := getenv("QUERYYER_URL", "http://localhost:8081/getPerson?name=")
+	queryyerURL := env.Get("QUERYYER_URL", "http://localhost:8081/getPerson/")
+	// queryyerURL_java := env.Get("QUERYYER_URL", "http://localhost:8081/getPerson?name=")
 	log.Print("querryerURL=\n", queryyerURL)
 
 	ctx, span := tracer.Start(ctx, "main_getPerson_function")
@@ -140,16 +236,85 @@ func getPerson(ctx context.Context, name string) (*model.Person, error) {
 	defer span.End()
 
 	url := queryyerURL + name
-	res, err := get(ctx, "getPerson", url)
+	res, err := get(ctx, queryyerClient, "getPerson", url)
+	if isStatus(err, http.StatusNotFound) {
+		// queryyer doesn't know the person, that's not a failure if we fall back
+		span.SetAttributes(attribute.Bool("person.found", false))
+		policy := env.Get("MISSING_PERSON_POLICY", missingPersonFallback)
+		if policy == missingPersonError {
+			err = fmt.Errorf("%w: %s", errPersonNotFound, name)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "person not found")
+			return nil, err
+		}
+		span.AddEvent("person not found, greeting by name only")
+		return &model.Person{Name: name}, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "getPerson failed")
+		return nil, err
+	}
 	var person model.Person
 	if err = json.Unmarshal(res, &person); err != nil {
 		return nil, err
 	}
+	span.SetAttributes(attribute.Bool("person.found", true))
 	return &person, nil
 }
 
+// getPeople is the batch version of getPerson, the people are returned in the order of names.
+// The unknown people are handled according to MISSING_PERSON_POLICY, like getPerson does.
+func getPeople(ctx context.Context, names []string) ([]*model.Person, error) {
+	queryyerURL := env.Get("QUERYYER_BATCH_URL", "http://localhost:8081/getPeople")
+	log.Print("querryerBatchURL=\n", queryyerURL)
+
+	ctx, span := tracer.Start(ctx, "main_getPeople_function")
+	span.SetAttributes(attribute.Int("batch.size", len(names)))
+	defer span.End()
+
+	res, err := get(ctx, queryyerClient, "getPeople", queryyerURL+"?"+url.Values{"name": names}.Encode())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "getPeople failed")
+		return nil, err
+	}
+	var batch model.PeopleBatch
+	if err = json.Unmarshal(res, &batch); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]model.Person, len(batch.Found))
+	for _, person := range batch.Found {
+		found[person.Name] = person
+	}
+	people := make([]*model.Person, 0, len(names))
+	var missing []string
+	for _, name := range names {
+		person, ok := found[name]
+		span.AddEvent("person looked up", trace.WithAttributes(
+			attribute.String("person.name", name),
+			attribute.Bool("person.found", ok),
+		))
+		if !ok {
+			missing = append(missing, name)
+			person = model.Person{Name: name}
+		}
+		people = append(people, &person)
+	}
+	span.SetAttributes(attribute.Int("batch.found", len(names)-len(missing)))
+
+	if len(missing) > 0 && env.Get("MISSING_PERSON_POLICY", missingPersonFallback) == missingPersonError {
+		err = fmt.Errorf("%w: %s", errPersonNotFound, strings.Join(missing, ", "))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "person not found")
+		return nil, err
+	}
+	return people, nil
+}
+
 func formatGreeting(ctx context.Context, person *model.Person) (string, error) {
-	formatterURL := getenv("FORMATTER_URL", "http://localhost:8082/formatGreeting?")
+	formatterURL := env.Get("FORMATTER_URL", "http://localhost:8082/formatGreeting?")
 
 	ctx, span := tracer.Start(ctx, "main_formatGreeting_function")
 	span.SetAttributes(attribute.String("person.Name", person.Name))
@@ -165,7 +330,7 @@ func formatGreeting(ctx context.Context, person *model.Person) (string, error) {
 	)))
 
 	url := formatterURL + v.Encode()
-	res, err := get(ctx, "formatGreeting", url)
+	res, err := get(ctx, formatterClient, "formatGreeting", url)
 	// log.Print(res)
 	if err != nil {
 		return "", err
@@ -173,21 +338,14 @@ func formatGreeting(ctx context.Context, person *model.Person) (string, error) {
 	return string(res), nil
 }
 
-func get(ctx context.Context, operationName, url string) ([]byte, error) {
+// get sends a GET request with client, every attempt is a child span of main-get-function
+func get(ctx context.Context, client *httpclient.Client, operationName, url string) ([]byte, error) {
 	ctx, span := tracer.Start(ctx, "main-get-function")
 	// Don't forget to end span!
 	defer span.End()
 
-	// NewTransport wraps the provided http.RoundTripper with one that starts a span
-	// and injects the span context into the outbound request headers.
-	var httpClient = http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-	}
-
-	// ContextWithValues returns a copy of parent with pairs updated in the baggage.
-	ctx = baggage.ContextWithValues(ctx,
-		attribute.String("username", "donuts"),
-	)
+	// the baggage of the request (e.g. the username set by the client) goes along, as far as
+	// BAGGAGE_ALLOWED_KEYS lets it in
 	// using additional httptrace plugin for tracing http (Super detail traces then about HTTP connection ;D )
 	// ctx = httptrace.WithClientTrace(ctx, otelhttptrace.NewClientTrace(ctx))
 
@@ -197,128 +355,44 @@ func get(ctx context.Context, operationName, url string) ([]byte, error) {
 	}
 	// Do request
 	log.Printf("Sending request...%s\n", operationName)
-	return DoWithClient(req, &httpClient)
+	return DoWithClient(req, client)
 }
 
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
+// healthURL is the liveness endpoint of the service of serviceURL
+func healthURL(serviceURL string) string {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return serviceURL
 	}
-	return value
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/healthz"}).String()
 }
 
 // DoWithClient executes an HTTP request and returns the response body.
-// Any errors or non-200 status code result in an error.
-func DoWithClient(req *http.Request, client *http.Client) ([]byte, error) {
-	_, span := tracer.Start(req.Context(), "DoWithClient")
+// Any errors or non-200 status code result in an error, a *StatusError for the latter.
+func DoWithClient(req *http.Request, client *httpclient.Client) ([]byte, error) {
+	ctx, span := tracer.Start(req.Context(), "DoWithClient")
 	// // Don't forget to end span!
 	defer span.End()
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	// the attempts (and the hedged requests) are children of this span
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request failed")
 		return nil, err
 	}
+	body := resp.Body
 	log.Printf("Response Received: %s\n", body)
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("StatusCode: %d, Body: %s", resp.StatusCode, body)
+		err := &StatusError{StatusCode: resp.StatusCode, Body: body}
+		span.RecordError(err)
+		// the 4xx are answers of the dependency, the caller decides whether they are errors
+		if resp.StatusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+		return nil, err
 	}
 
 	return body, nil
 }
-
-func initProvider() {
-	ctx := context.Background()
-
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		// setting default endpoint for exporter
-		// in case of sidecar gonna work as well
-		endpoint = "127.0.0.1:4317"
-	}
-
-	// Create new OTLP Exporter
-	driver := otlpgrpc.NewDriver(
-		otlpgrpc.WithInsecure(),
-		otlpgrpc.WithEndpoint(endpoint),
-		otlpgrpc.WithDialOption(),
-		// otlpgrpc.WithDialOption(grpc.WithBlock()), // useful for testing/debuging
-		// because it's not going to pass this line if it couldn't find and connect to the agent
-	)
-	exporter, err := otlp.NewExporter(ctx, driver)
-	handleErr(err, "failed to create new OTLP exporter")
-
-	// if you want to have specific kind of trace ID,
-	// for instance if you want to set up the otel collector to export traces to both aws cloudwatch
-	// and another jaeger instance
-	idg := xray.NewIDGenerator()
-
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String("main"),
-		),
-	)
-	handleErr(err, "failed to create resource")
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSyncer(exporter),
-		sdktrace.WithIDGenerator(idg),
-	)
-
-	cont := controller.New(
-		processor.New(
-			simple.NewWithExactDistribution(),
-			exporter,
-		),
-		controller.WithExporter(exporter),
-		controller.WithCollectPeriod(2*time.Second),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(xray.Propagator{})
-	// if you are using the meter (you need also enable it in the agent config)
-	// global.SetMeterProvider(cont.MeterProvider())
-	_ = cont.Start(ctx)
-}
-
-func initProviderJaeger() {
-
-	// We get the jaeger collector endpoint (in case we want to send traces straightly to the collector)
-	jaegerCollectorURL := getenv("JAEGER_COLLECTOR_URL", "http://localhost:14268/api/traces")
-	// Getting the Agent information
-	jaegerAgenthost := getenv("JAEGER_AGENT_NAME", "localhost")
-	jaegerAgentport := getenv("JAEGER_AGENT_PORT", "5775")
-
-	// Created another package file for this part (as required some more comments)
-	// tracing.TracerProvider returns an OpenTelemetry TracerProvider configured to use
-	// the Jaeger exporter that will send spans to the provided url. The returned
-	// TracerProvider will also use a Resource configured with all the information
-	// about the application.
-	tp, err := tracing.TracerProvider(jaegerCollectorURL, jaegerAgenthost, jaegerAgentport, service, environment, id)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Register our TracerProvider as the global so any imported
-	// instrumentation in the future will default to using it.
-	// SetTracerProvider registers `tp` as the global trace provider.
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-
-}
-
-func handleErr(err error, message string) {
-	if err != nil {
-		log.Fatalf("%s: %v", message, err)
-	}
-}
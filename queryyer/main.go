@@ -5,34 +5,28 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
+	"medium-opentelemetry-poc/lib/env"
+	"medium-opentelemetry-poc/lib/fault"
+	"medium-opentelemetry-poc/lib/health"
+	"medium-opentelemetry-poc/lib/model"
+	"medium-opentelemetry-poc/lib/server"
 	"medium-opentelemetry-poc/lib/tracing"
 	"medium-opentelemetry-poc/queryyer/people"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
-	"go.opentelemetry.io/otel/propagation"
-	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
-	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
-	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	"go.opentelemetry.io/otel/semconv"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var repo *people.Repository
+var repo people.PersonStore
 
 const (
 	service     = "queryyer"
@@ -43,58 +37,114 @@ const (
 var tracer = otel.Tracer("queryyer-service")
 
 func main() {
-	// We have two configuration, either using otel collector as agent/collector
-	// or using the jaeger agent/collector, to export traces to
-	tracingOption := getenv("TRACING_OPTION", "otel-collector")
+	// Important to defer the cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	if tracingOption == "otel-collector" {
-		initProvider()
-	} else if tracingOption == "jaeger-collector" {
-		initProviderJaeger()
+	// We have two configuration, either using otel collector as agent/collector
+	// or using the jaeger agent/collector, to export traces (TRACING_OPTION)
+	opts := tracing.OptionsFromEnv(service, environment, id)
+	shutdown, err := tracing.Setup(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	// Cleanly shutdown and flush telemetry when the application exits.
-	defer func(ctx context.Context) {
-		// Do not make the application hang when it is shutdown.
-		ctx, cancel = context.WithTimeout(ctx, time.Second*5)
-		defer cancel()
-	}(ctx)
+	// `queryyer migrate` only applies the migrations of the MySQL database then exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := migrate(ctx)
+		if serr := shutdown(ctx); err == nil {
+			err = serr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	//Main functionality
-	repo = people.NewRepository()
-	defer repo.Close()
+	// MySQL by default, or the in-memory/file store to run without docker (PEOPLE_STORE)
+	repo, err = people.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the database may not be up yet, we serve (503) meanwhile and stop if it never comes up
+	storeErr := make(chan error, 1)
+	go func() {
+		if err := people.WaitReady(ctx, repo); err != nil && ctx.Err() == nil {
+			storeErr <- err
+			cancel()
+		}
+	}()
+
+	// errors and latency injected on purpose, none unless configured (FAULT_INJECTION_*)
+	faults, err := fault.InjectorFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	wrappedHandler := otelhttp.NewHandler(http.HandlerFunc(handleGetPerson), "/getPerson/")
+	wrappedHandler := tracing.NewHandler(faults.Wrap(http.HandlerFunc(handleGetPerson), "/getPerson/"), "/getPerson/")
 	http.Handle("/getPerson/", wrappedHandler)
 
-	log.Print("Listening on :8081/")
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	// many people at once (/getPeople?name=EQ&name=Margo), with a single query
+	http.Handle("/getPeople", tracing.NewHandler(faults.Wrap(http.HandlerFunc(handleGetPeople), "/getPeople"), "/getPeople"))
+
+	// REST API to manage the people (list, create, get, replace, patch, delete)
+	peopleHandler := people.NewHandler(repo)
+	http.Handle("/people", tracing.NewHandler(faults.Wrap(peopleHandler, "/people"), "/people"))
+	http.Handle("/people/", tracing.NewHandler(faults.Wrap(peopleHandler, "/people/"), "/people/"))
+
+	// /healthz and /readyz, not traced. Ready once the store is (the database is reachable)
+	checker := &health.Checker{}
+	checker.Add("people-store", func(ctx context.Context) error {
+		return people.Check(ctx, repo)
+	})
+	if check := tracing.ExporterCheck(opts); check != nil {
+		checker.AddOptional("exporter", check)
+	}
+	health.Register(http.DefaultServeMux, checker)
+
+	srv := &http.Server{Addr: env.Get("PORT", ":8081")}
 
+	// Serve until SIGTERM, then drain the requests, close the db and flush the telemetry before exiting
+	closeRepo := func(context.Context) error {
+		return repo.Close()
+	}
+	if err := server.Run(ctx, srv, server.ShutdownTimeoutFromEnv(), closeRepo, shutdown); err != nil {
+		log.Fatal(err)
+	}
+	select {
+	case err := <-storeErr:
+		log.Fatal(err)
+	default:
+	}
 }
 
 func handleGetPerson(w http.ResponseWriter, r *http.Request) {
-	// UsernameKey which sent as baggage
-	uk := attribute.Key("username")
 	// Getting the context from the request
 	ctx := r.Context()
 	// Starting a new trace in continous of received one
+	// (the username sent as baggage is copied onto the spans, see BAGGAGE_SPAN_ATTRIBUTES)
 	ctx, span := tracer.Start(ctx, "handleGetPerson")
 	defer span.End()
-	// Getting the value of the baggage
-	username := baggage.Value(ctx, uk)
 	// Creating an event
-	span.AddEvent("handling this...", trace.WithAttributes(uk.String(username.AsString())))
+	span.AddEvent("handling this...")
 
 	// getting the name out of api url
 	name := strings.TrimPrefix(r.URL.Path, "/getPerson/")
 	person, err := repo.GetPerson(ctx, name)
 	log.Print("person", person)
+	if errors.Is(err, people.ErrNotFound) {
+		// not a failure of queryyer, the caller decides what to do with unknown people
+		span.RecordError(err)
+		span.SetAttributes(attribute.Bool("person.found", false))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
+		// 503 while the database is not reachable yet, 500 otherwise
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "handleGetPerson-queryyer")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), people.StatusCode(err))
 		return
 	}
 	log.Print(person)
@@ -107,85 +157,75 @@ func handleGetPerson(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
+// migrate applies the pending migrations of the MySQL database
+func migrate(ctx context.Context) error {
+	r, err := people.OpenRepository()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := r.Migrate(ctx); err != nil {
+		return err
 	}
-	return value
+	log.Print("the database is up to date")
+	return nil
 }
 
-func initProvider() {
-	ctx := context.Background()
-
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "127.0.0.1:4317" // setting default endpoint for exporter
-	}
-
-	// Create new OTLP Exporter
-	driver := otlpgrpc.NewDriver(
-		otlpgrpc.WithInsecure(),
-		otlpgrpc.WithEndpoint(endpoint),
-		otlpgrpc.WithDialOption(),
-		//otlpgrpc.WithDialOption(grpc.WithBlock()), // useful for testing
-	)
-	exporter, err := otlp.NewExporter(ctx, driver)
-	handleErr(err, "failed to create new OTLP exporter")
-
-	idg := xray.NewIDGenerator()
-
-	service := os.Getenv("GO_GORILLA_SERVICE_NAME")
-	if service == "" {
-		service = "go-gorilla"
-	}
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String("queryyer"),
-		),
-	)
-	handleErr(err, "failed to create resource")
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSyncer(exporter),
-		sdktrace.WithIDGenerator(idg),
-	)
-
-	cont := controller.New(
-		processor.New(
-			simple.NewWithExactDistribution(),
-			exporter,
-		),
-		controller.WithExporter(exporter),
-		controller.WithCollectPeriod(2*time.Second),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(xray.Propagator{})
-	// if you want to set the meter (you need also enable it in the agent config)
-	// global.SetMeterProvider(cont.MeterProvider())
-	_ = cont.Start(ctx)
-}
+// maxBatchSize limits the names of a /getPeople request, they all end up in one IN query
+const maxBatchSize = 100
+
+func handleGetPeople(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "handleGetPeople")
+	defer span.End()
 
-func initProviderJaeger() {
-	jaegerCollectorURL := getenv("JAEGER_COLLECTOR_URL", "http://localhost:14268/api/traces")
-	jaegerAgenthost := getenv("JAEGER_AGENT_NAME", "localhost")
-	jaegerAgentport := getenv("JAEGER_AGENT_PORT", "5775")
-	tp, err := tracing.TracerProvider(jaegerCollectorURL, jaegerAgenthost, jaegerAgentport, service, environment, id)
+	// the duplicates are looked up once
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range r.URL.Query()["name"] {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	span.SetAttributes(attribute.Int("batch.size", len(names)))
+	if len(names) == 0 {
+		http.Error(w, "no name to look up, expected /getPeople?name=...&name=...", http.StatusBadRequest)
+		return
+	}
+	if len(names) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("too many names, at most %d per request", maxBatchSize), http.StatusBadRequest)
+		return
+	}
 
+	found, err := repo.GetPeople(ctx, names)
 	if err != nil {
-		log.Fatal(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "handleGetPeople-queryyer")
+		http.Error(w, err.Error(), people.StatusCode(err))
+		return
 	}
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
-}
+	// one event per name, so the trace tells which ones were unknown
+	batch := model.PeopleBatch{Found: []model.Person{}, Missing: []string{}}
+	for _, name := range names {
+		person, ok := found[name]
+		span.AddEvent("person looked up", trace.WithAttributes(
+			attribute.String("person.name", name),
+			attribute.Bool("person.found", ok),
+		))
+		if ok {
+			batch.Found = append(batch.Found, person)
+		} else {
+			batch.Missing = append(batch.Missing, name)
+		}
+	}
+	span.SetAttributes(attribute.Int("batch.found", len(batch.Found)))
 
-func handleErr(err error, message string) {
+	bytes, err := json.Marshal(batch)
 	if err != nil {
-		log.Fatalf("%s: %v", message, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"medium-opentelemetry-poc/lib/model"
+	"medium-opentelemetry-poc/queryyer/people"
+)
+
+// failingStore is a store whose database is not reachable yet
+type failingStore struct {
+	*people.MemoryStore
+}
+
+func (failingStore) GetPeople(context.Context, []string) (map[string]model.Person, error) {
+	return nil, fmt.Errorf("%w: dial tcp: connection refused", people.ErrNotReady)
+}
+
+func TestHandleGetPeople(t *testing.T) {
+	margo := model.Person{Name: "Margo", Title: "Ms.", Description: "Privet!"}
+	names := func(n int) []string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("person-%d", i)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name       string
+		store      people.PersonStore
+		names      []string
+		wantStatus int
+		want       model.PeopleBatch
+	}{
+		{
+			name: "found and missing", names: []string{"Margo", "Alice", "Margo"}, wantStatus: http.StatusOK,
+			want: model.PeopleBatch{Found: []model.Person{margo}, Missing: []string{"Alice"}},
+		},
+		{name: "no name", wantStatus: http.StatusBadRequest},
+		{name: "empty names", names: []string{"", ""}, wantStatus: http.StatusBadRequest},
+		{
+			name: "as many names as allowed", names: names(maxBatchSize), wantStatus: http.StatusOK,
+			want: model.PeopleBatch{Found: []model.Person{}, Missing: names(maxBatchSize)},
+		},
+		{name: "too many names", names: names(maxBatchSize + 1), wantStatus: http.StatusBadRequest},
+		{
+			name: "duplicates count once", names: append(names(maxBatchSize), "person-0"), wantStatus: http.StatusOK,
+			want: model.PeopleBatch{Found: []model.Person{}, Missing: names(maxBatchSize)},
+		},
+		{name: "store not ready", store: failingStore{people.NewMemoryStore()}, names: []string{"Margo"}, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo = people.NewMemoryStore(margo)
+			if tt.store != nil {
+				repo = tt.store
+			}
+			t.Cleanup(func() { repo = nil })
+
+			rec := httptest.NewRecorder()
+			handleGetPeople(rec, httptest.NewRequest(http.MethodGet, "/getPeople?"+url.Values{"name": tt.names}.Encode(), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got model.PeopleBatch
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package people
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"medium-opentelemetry-poc/lib/model"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache keeps the people looked up by CachedStore. LRUCache is the in-process one, a cache
+// shared by the replicas of queryyer (e.g. redis) only has to implement this interface.
+type Cache interface {
+	// Get returns the person cached by name, false if there is none (or it expired)
+	Get(ctx context.Context, name string) (model.Person, bool)
+	// Set caches p by name
+	Set(ctx context.Context, name string, p model.Person)
+	// Delete removes the person cached by name, if any
+	Delete(ctx context.Context, name string)
+}
+
+// The attributes of the cache, on the span of the request
+const (
+	cacheHitKey    = attribute.Key("cache.hit")
+	cacheHitsKey   = attribute.Key("cache.hits")
+	cacheMissesKey = attribute.Key("cache.misses")
+)
+
+// CachedStore is a read-through cache in front of a PersonStore: GetPerson and GetPeople are
+// answered from the cache when they can, the modifications go to the store and invalidate the cache.
+// Only the known people are cached, so a new person is found right away.
+type CachedStore struct {
+	PersonStore
+	cache   Cache
+	lookups metric.Int64Counter
+	// foldCase is set when the store matches the names whatever their case (MySQL), the
+	// cache is keyed by the lower case names then
+	foldCase bool
+
+	// mu orders the writes of the lookups to the cache with the invalidations, see startLookup
+	mu      sync.Mutex
+	pending map[string]*pendingLookups
+}
+
+// pendingLookups are the lookups of a name missed by the cache and running against the store
+type pendingLookups struct {
+	count int
+	// generation is incremented when the name is invalidated, the lookups which started
+	// before don't cache what they found: it may be older than the modification
+	generation uint64
+}
+
+// caseInsensitiveStore is implemented by the stores which match the names whatever their case
+type caseInsensitiveStore interface {
+	CaseInsensitive() bool
+}
+
+// NewCachedStore puts cache in front of store.
+func NewCachedStore(store PersonStore, cache Cache) *CachedStore {
+	meter := metric.Must(global.Meter("medium-opentelemetry-poc/queryyer/people"))
+	s := &CachedStore{
+		PersonStore: store,
+		cache:       cache,
+		lookups: meter.NewInt64Counter("people.cache.lookups",
+			metric.WithDescription("Number of people looked up in the cache, by cache.hit")),
+		pending: map[string]*pendingLookups{},
+	}
+	if cis, ok := store.(caseInsensitiveStore); ok {
+		s.foldCase = cis.CaseInsensitive()
+	}
+	return s
+}
+
+// key is the key of name in the cache, normalized like the store compares the names
+func (s *CachedStore) key(name string) string {
+	if s.foldCase {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// get returns the person cached for name, with the name as it was asked for (like the
+// case insensitive stores answer)
+func (s *CachedStore) get(ctx context.Context, name string) (model.Person, bool) {
+	p, ok := s.cache.Get(ctx, s.key(name))
+	if ok {
+		p.Name = name
+	}
+	return p, ok
+}
+
+// startLookup registers a lookup of key in the store, it must be finished with endLookup.
+// It returns the generation of key, endLookup caches the person only if key was not
+// invalidated in the meantime: otherwise a lookup reading the store before an update
+// would cache the old person after the update invalidated it, until the ttl.
+func (s *CachedStore) startLookup(key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.pending[key]
+	if !ok {
+		l = &pendingLookups{}
+		s.pending[key] = l
+	}
+	l.count++
+	return l.generation
+}
+
+// endLookup finishes a lookup of key started at generation, and caches p if found
+func (s *CachedStore) endLookup(ctx context.Context, key string, generation uint64, p model.Person, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.pending[key]
+	if l.count--; l.count == 0 {
+		delete(s.pending, key)
+	}
+	if found && l.generation == generation {
+		s.cache.Set(ctx, key, p)
+	}
+}
+
+// invalidate removes name from the cache and keeps the pending lookups from caching it
+func (s *CachedStore) invalidate(ctx context.Context, name string) {
+	key := s.key(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.pending[key]; ok {
+		l.generation++
+	}
+	s.cache.Delete(ctx, key)
+}
+
+// GetPerson returns the cached person, or looks it up in the store and caches it.
+func (s *CachedStore) GetPerson(ctx context.Context, name string) (model.Person, error) {
+	span := trace.SpanFromContext(ctx)
+	if p, ok := s.get(ctx, name); ok {
+		span.SetAttributes(cacheHitKey.Bool(true))
+		s.lookups.Add(ctx, 1, cacheHitKey.Bool(true))
+		return p, nil
+	}
+	span.SetAttributes(cacheHitKey.Bool(false))
+	s.lookups.Add(ctx, 1, cacheHitKey.Bool(false))
+
+	key := s.key(name)
+	generation := s.startLookup(key)
+	p, err := s.PersonStore.GetPerson(ctx, name)
+	s.endLookup(ctx, key, generation, p, err == nil)
+	return p, err
+}
+
+// GetPeople returns the cached people and looks the others up in the store, at once.
+func (s *CachedStore) GetPeople(ctx context.Context, names []string) (map[string]model.Person, error) {
+	people := make(map[string]model.Person, len(names))
+	var missing []string
+	for _, name := range names {
+		if p, ok := s.get(ctx, name); ok {
+			people[name] = p
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	hits := len(names) - len(missing)
+	trace.SpanFromContext(ctx).SetAttributes(cacheHitsKey.Int(hits), cacheMissesKey.Int(len(missing)))
+	s.lookups.Add(ctx, int64(hits), cacheHitKey.Bool(true))
+	s.lookups.Add(ctx, int64(len(missing)), cacheHitKey.Bool(false))
+	if len(missing) == 0 {
+		return people, nil
+	}
+
+	generations := make([]uint64, len(missing))
+	for i, name := range missing {
+		generations[i] = s.startLookup(s.key(name))
+	}
+	found, err := s.PersonStore.GetPeople(ctx, missing)
+	for i, name := range missing {
+		p, ok := found[name]
+		s.endLookup(ctx, s.key(name), generations[i], p, ok && err == nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, p := range found {
+		people[name] = p
+	}
+	return people, nil
+}
+
+// CreatePerson creates p in the store and invalidates its cache entry.
+func (s *CachedStore) CreatePerson(ctx context.Context, p model.Person) error {
+	defer s.invalidate(ctx, p.Name)
+	return s.PersonStore.CreatePerson(ctx, p)
+}
+
+// UpdatePerson updates p in the store and invalidates its cache entry.
+func (s *CachedStore) UpdatePerson(ctx context.Context, p model.Person) error {
+	// invalidated even if the update fails, we don't know whether the database got it
+	defer s.invalidate(ctx, p.Name)
+	return s.PersonStore.UpdatePerson(ctx, p)
+}
+
+// DeletePerson deletes the person from the store and invalidates its cache entry.
+func (s *CachedStore) DeletePerson(ctx context.Context, name string) error {
+	defer s.invalidate(ctx, name)
+	return s.PersonStore.DeletePerson(ctx, name)
+}
+
+// LRUCache is an in-process Cache of a limited size, the least recently used people are
+// evicted first and the people expire after a while (ttl).
+// The expiration bounds how stale the cache can be when the people are modified through
+// another replica of queryyer.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// order has the most recently used entry at the front
+	order *list.List
+}
+
+type lruEntry struct {
+	name    string
+	person  model.Person
+	expires time.Time
+}
+
+// NewLRUCache creates an LRUCache of size people at most, which expire after ttl (0 never expires).
+func NewLRUCache(size int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// Get implements Cache.
+func (c *LRUCache) Get(_ context.Context, name string) (model.Person, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[name]
+	if !ok {
+		return model.Person{}, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return model.Person{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.person, true
+}
+
+// Set implements Cache.
+func (c *LRUCache) Set(_ context.Context, name string, p model.Person) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[name]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.person, entry.expires = p, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[name] = c.order.PushFront(&lruEntry{name: name, person: p, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete implements Cache.
+func (c *LRUCache) Delete(_ context.Context, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[name]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove drops elem, the caller holds the lock
+func (c *LRUCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry).name)
+}
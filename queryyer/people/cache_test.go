@@ -0,0 +1,108 @@
+package people
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+// slowStore is a MemoryStore whose GetPerson reads the person, then waits for release
+// before answering (a lookup racing a modification)
+type slowStore struct {
+	*MemoryStore
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStore) GetPerson(ctx context.Context, name string) (model.Person, error) {
+	p, err := s.MemoryStore.GetPerson(ctx, name)
+	s.read <- struct{}{}
+	<-s.release
+	return p, err
+}
+
+func TestCachedStoreDoesNotCacheALookupOlderThanAnUpdate(t *testing.T) {
+	ctx := context.Background()
+	backend := &slowStore{
+		MemoryStore: NewMemoryStore(model.Person{Name: "Margo", Title: "Ms."}),
+		read:        make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	store := NewCachedStore(backend, NewLRUCache(10, time.Minute))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := store.GetPerson(ctx, "Margo"); err != nil {
+			t.Errorf("failed to get the person: %v", err)
+		}
+	}()
+	<-backend.read
+	// the lookup has the old title, the update invalidates the name before it's cached
+	if err := store.UpdatePerson(ctx, model.Person{Name: "Margo", Title: "Dr."}); err != nil {
+		t.Fatalf("failed to update the person: %v", err)
+	}
+	close(backend.release)
+	<-done
+
+	go func() {
+		for range backend.read {
+		}
+	}()
+	p, err := store.GetPerson(ctx, "Margo")
+	if err != nil {
+		t.Fatalf("failed to get the person: %v", err)
+	}
+	if p.Title != "Dr." {
+		t.Errorf("expected the updated title, got the stale %q", p.Title)
+	}
+	if len(store.pending) != 0 {
+		t.Errorf("expected no pending lookup left, got %d", len(store.pending))
+	}
+	close(backend.read)
+}
+
+// foldingStore is a MemoryStore matching the names whatever their case, like MySQL
+type foldingStore struct {
+	*MemoryStore
+}
+
+func (foldingStore) CaseInsensitive() bool { return true }
+
+func (s foldingStore) GetPerson(ctx context.Context, name string) (model.Person, error) {
+	p, err := s.MemoryStore.GetPerson(ctx, strings.ToLower(name))
+	p.Name = name
+	return p, err
+}
+
+func (s foldingStore) UpdatePerson(ctx context.Context, p model.Person) error {
+	p.Name = strings.ToLower(p.Name)
+	return s.MemoryStore.UpdatePerson(ctx, p)
+}
+
+func TestCachedStoreInvalidatesEveryCaseOfAName(t *testing.T) {
+	ctx := context.Background()
+	store := NewCachedStore(foldingStore{NewMemoryStore(model.Person{Name: "bob", Title: "Mr."})}, NewLRUCache(10, time.Minute))
+
+	if _, err := store.GetPerson(ctx, "bob"); err != nil {
+		t.Fatalf("failed to get the person: %v", err)
+	}
+	if err := store.UpdatePerson(ctx, model.Person{Name: "Bob", Title: "Dr."}); err != nil {
+		t.Fatalf("failed to update the person: %v", err)
+	}
+	p, err := store.GetPerson(ctx, "bob")
+	if err != nil {
+		t.Fatalf("failed to get the person: %v", err)
+	}
+	if p.Title != "Dr." {
+		t.Errorf("expected the updated title, got the stale %q", p.Title)
+	}
+
+	// cached as "bob", answered with the name as asked
+	if p, _ := store.GetPerson(ctx, "BOB"); p.Name != "BOB" || p.Title != "Dr." {
+		t.Errorf("expected the cached person named as asked, got %+v", p)
+	}
+}
@@ -0,0 +1,61 @@
+package people
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrNotFound is matched (errors.Is) by the NotFoundError returned when there is no
+	// person with the given name
+	ErrNotFound = errors.New("person not found")
+	// ErrConflict is returned when creating a person whose name is already taken
+	ErrConflict = errors.New("person already exists")
+	// ErrNotReady is returned while the store is not usable yet (e.g. the database is down
+	// when queryyer starts)
+	ErrNotReady = errors.New("people store not ready")
+)
+
+// NotFoundError is returned by the stores when there is no person with the given name,
+// errors.Is(err, ErrNotFound) tells it apart from the failures of the store.
+type NotFoundError struct {
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("person %q not found", e.Name)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// The attributes of the spans of the stores
+const (
+	personNameKey  = attribute.Key("person.name")
+	peopleCountKey = attribute.Key("people.count")
+	batchSizeKey   = attribute.Key("batch.size")
+)
+
+// isClientError tells the errors caused by the request rather than by the store
+func isClientError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict)
+}
+
+// StatusCode is the http status code answering err, an error of a store
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrNotReady):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
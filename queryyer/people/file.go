@@ -0,0 +1,86 @@
+package people
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+// DefaultStorePath is the file of the FileStore when PEOPLE_STORE_PATH is not set
+const DefaultStorePath = "people.json"
+
+// FileStore is a PersonStore keeping the people in a JSON file, so they survive a restart
+// without running a database next to queryyer. The whole file is read at start and the
+// lookups are answered from memory.
+//
+// We don't use SQLite here: the images are built with CGO_ENABLED=0, and a file is enough
+// for the handful of people of this demo.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore opens the FileStore at path. If the file doesn't exist yet, it is created
+// with the people of the fixtures SQL file (see LoadFixtures), if any.
+// Every modification rewrites the file.
+func NewFileStore(path, fixtures string) (*FileStore, error) {
+	s := &FileStore{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		var people []model.Person
+		if err := json.Unmarshal(data, &people); err != nil {
+			return nil, err
+		}
+		s.MemoryStore = NewMemoryStore(people...)
+	case errors.Is(err, os.ErrNotExist):
+		people, err := LoadFixtures(fixtures)
+		if err != nil {
+			log.Printf("starting with no people in %s: %v", path, err)
+		}
+		s.MemoryStore = NewMemoryStore(people...)
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	s.backend = StoreFile
+	s.onChange = s.save
+	return s, nil
+}
+
+// save writes the people to the file, the caller holds the lock.
+// The file is replaced at once (rename) so a crash never leaves it half written.
+func (s *FileStore) save() error {
+	people := make([]model.Person, 0, len(s.people))
+	for _, p := range s.people {
+		people = append(people, p)
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].Name < people[j].Name })
+	data, err := json.MarshalIndent(people, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
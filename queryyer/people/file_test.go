@@ -0,0 +1,104 @@
+package people
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+// readPeopleFile returns the people saved in the file at path
+func readPeopleFile(t *testing.T, path string) []model.Person {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var people []model.Person
+	if err := json.Unmarshal(data, &people); err != nil {
+		t.Fatalf("invalid people file: %v", err)
+	}
+	return people
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fixtures := filepath.Join(dir, "people.sql")
+	if err := ioutil.WriteFile(fixtures, []byte(`INSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!');`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "people.json")
+
+	store, err := NewFileStore(path, fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readPeopleFile(t, path); !reflect.DeepEqual(got, []model.Person{margo}) {
+		t.Errorf("expected the new file to hold the fixtures, got %+v", got)
+	}
+
+	if err := store.CreatePerson(ctx, farhad); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeletePerson(ctx, "Margo"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readPeopleFile(t, path); !reflect.DeepEqual(got, []model.Person{farhad}) {
+		t.Errorf("expected every modification to be saved, got %+v", got)
+	}
+
+	// the file wins over the fixtures once it exists
+	reopened, err := NewFileStore(path, fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := reopened.GetPerson(ctx, "Farhad"); err != nil || p != farhad {
+		t.Errorf("expected the people of the file, got %+v, %v", p, err)
+	}
+	if _, err := reopened.GetPerson(ctx, "Margo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the deleted person to stay deleted, got %v", err)
+	}
+}
+
+func TestFileStoreRevertsWhenItCantSave(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "store")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileStore(filepath.Join(dir, "people.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := store.ListPeople(ctx)
+	// the file can't be written anymore
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CreatePerson(ctx, model.Person{Name: "Alice"}); err == nil {
+		t.Fatal("expected the error of the save")
+	}
+	if _, err := store.GetPerson(ctx, "Alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the person not to be kept, got %v", err)
+	}
+	if after, _ := store.ListPeople(ctx); !reflect.DeepEqual(before, after) {
+		t.Errorf("expected the people to be left as they were saved, got %+v", after)
+	}
+}
+
+func TestFileStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.json")
+	if err := ioutil.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path, ""); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
@@ -0,0 +1,252 @@
+package people
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+// LoadFixtures reads the people the in-memory and file stores are seeded with: those inserted
+// by the SQL file at path, or by the migrations of the MySQL database if path is empty.
+func LoadFixtures(path string) ([]model.Person, error) {
+	if path != "" {
+		return LoadFixturesFile(path)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var people []model.Person
+	for _, m := range migrations {
+		p, err := ParseFixtures(strings.NewReader(strings.Join(m.Statements, ";\n")))
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, p...)
+	}
+	return people, nil
+}
+
+// LoadFixturesFile reads the people inserted by the SQL file at path (see ParseFixtures).
+func LoadFixturesFile(path string) ([]model.Person, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the people fixtures: %w", err)
+	}
+	defer f.Close()
+	return ParseFixtures(f)
+}
+
+// ParseFixtures reads the people inserted by a db/database.sql-style script, that is the
+// `INSERT [IGNORE] INTO ... people [(columns)] VALUES ('name', 'title', 'description')[, (...)];`
+// statements. Everything else (CREATE, DELETE...) is skipped, the script is an error if it
+// can't be parsed (unterminated string, missing values...) so no person is silently left out.
+func ParseFixtures(r io.Reader) ([]model.Person, error) {
+	script, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var people []model.Person
+	for _, stmt := range splitStatements(string(script)) {
+		p, err := parseInsert(stmt)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, p...)
+	}
+	return people, nil
+}
+
+// splitStatements splits script on the semicolons which are not quoted, leaving out
+// the comments (-- and #) and the empty statements
+func splitStatements(script string) []string {
+	var stmts []string
+	var stmt strings.Builder
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(script) {
+				stmt.WriteByte(c)
+				i++
+				c = script[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || isDashComment(script[i:]):
+			// skip the comment, up to the end of the line
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			c = '\n'
+		case c == ';':
+			if s := strings.TrimSpace(stmt.String()); s != "" {
+				stmts = append(stmts, s)
+			}
+			stmt.Reset()
+			continue
+		}
+		stmt.WriteByte(c)
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// isDashComment tells whether s starts with a -- comment: like MySQL, the dashes must be
+// followed by a whitespace (or the end of the script), --x is not a comment
+func isDashComment(s string) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || strings.IndexByte(" \t\n\r\f\v", s[2]) >= 0
+}
+
+// isKeyword tells whether word can start a SQL statement (SELECT, CREATE...)
+func isKeyword(word string) bool {
+	for _, c := range word {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return word != ""
+}
+
+// parseInsert returns the people inserted by stmt, none if it's not an insert into the people
+// table. A statement which doesn't start with a keyword is an error, rather than being skipped
+// with the people it may insert.
+func parseInsert(stmt string) ([]model.Person, error) {
+	stmt = strings.TrimSpace(stmt)
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 || !isKeyword(fields[0]) {
+		return nil, fmt.Errorf("invalid fixture %q: not a SQL statement", stmt)
+	}
+	if !strings.EqualFold(fields[0], "INSERT") {
+		return nil, nil
+	}
+	// INSERT [IGNORE] [INTO] table
+	fields = fields[1:]
+	if len(fields) > 0 && strings.EqualFold(fields[0], "IGNORE") {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && strings.EqualFold(fields[0], "INTO") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid fixture %q: no table", stmt)
+	}
+	table := fields[0]
+	if i := strings.IndexByte(table, '('); i >= 0 {
+		table = table[:i]
+	}
+	table = strings.ReplaceAll(table, "`", "")
+	if table != "people" && !strings.HasSuffix(table, ".people") {
+		return nil, nil
+	}
+
+	upper := strings.ToUpper(stmt)
+	values := strings.Index(upper, "VALUES")
+	if values < 0 {
+		return nil, fmt.Errorf("invalid fixture %q: no VALUES", stmt)
+	}
+	columns := []string{"name", "title", "description"}
+	if open := strings.IndexByte(stmt[:values], '('); open >= 0 {
+		end := strings.IndexByte(stmt[open:values], ')')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid fixture %q: unclosed column list", stmt)
+		}
+		columns = strings.Split(stmt[open+1:open+end], ",")
+		for i := range columns {
+			columns[i] = strings.ToLower(strings.Trim(strings.TrimSpace(columns[i]), "`"))
+		}
+	}
+
+	tuples, err := parseTuples(stmt[values+len("VALUES"):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture %q: %w", stmt, err)
+	}
+	people := make([]model.Person, 0, len(tuples))
+	for _, tuple := range tuples {
+		if len(tuple) != len(columns) {
+			return nil, fmt.Errorf("invalid fixture %q: %d values for %d columns", stmt, len(tuple), len(columns))
+		}
+		var p model.Person
+		for i, column := range columns {
+			switch column {
+			case "name":
+				p.Name = tuple[i]
+			case "title":
+				p.Title = tuple[i]
+			case "description":
+				p.Description = tuple[i]
+			}
+		}
+		people = append(people, p)
+	}
+	return people, nil
+}
+
+// parseTuples parses `('a', 'b', NULL), (...)`, NULL is read as an empty string
+func parseTuples(s string) ([][]string, error) {
+	var tuples [][]string
+	var tuple []string
+	inTuple := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == '(' && !inTuple:
+			inTuple, tuple = true, nil
+		case c == ')' && inTuple:
+			inTuple = false
+			tuples = append(tuples, tuple)
+		case c == ',':
+		case (c == '\'' || c == '"') && inTuple:
+			value, n, err := parseString(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			tuple = append(tuple, value)
+			i += n - 1
+		case inTuple && len(s) >= i+4 && strings.EqualFold(s[i:i+4], "NULL"):
+			tuple = append(tuple, "")
+			i += 3
+		default:
+			return nil, fmt.Errorf("unexpected %q", s[i:])
+		}
+	}
+	if inTuple {
+		return nil, fmt.Errorf("unclosed tuple")
+	}
+	return tuples, nil
+}
+
+// parseString reads the quoted string at the start of s, the quote is escaped either by
+// doubling it or with a backslash. It returns the value and the number of bytes read.
+func parseString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+			b.WriteByte(quote)
+		case c == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %q", s)
+}
@@ -0,0 +1,124 @@
+package people
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+func TestParseFixtures(t *testing.T) {
+	margo := model.Person{Name: "Margo", Title: "Ms.", Description: "Privet!"}
+	tests := []struct {
+		name   string
+		script string
+		want   []model.Person
+	}{
+		{name: "insert", script: `INSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!');`, want: []model.Person{margo}},
+		{name: "insert ignore", script: `insert ignore into people values ('Margo', 'Ms.', 'Privet!')`, want: []model.Person{margo}},
+		{name: "without into", script: `INSERT people VALUES ('Margo', 'Ms.', 'Privet!');`, want: []model.Person{margo}},
+		{name: "database and backquotes", script: "INSERT INTO `db`.`people` VALUES ('Margo', 'Ms.', 'Privet!');", want: []model.Person{margo}},
+		{
+			name:   "multi-row values",
+			script: "INSERT INTO people VALUES\n  ('Margo', 'Ms.', 'Privet!'),\n  ('Trace', 'Mr.', 'This is so cool!');",
+			want:   []model.Person{margo, {Name: "Trace", Title: "Mr.", Description: "This is so cool!"}},
+		},
+		{
+			name:   "column list",
+			script: "INSERT INTO people (`description`, name) VALUES ('Privet!', 'Margo');",
+			want:   []model.Person{{Name: "Margo", Description: "Privet!"}},
+		},
+		{
+			name:   "column list without space",
+			script: "INSERT INTO `people`(name, title, description) VALUES ('Margo', 'Ms.', 'Privet!');",
+			want:   []model.Person{margo},
+		},
+		{name: "NULL", script: `INSERT INTO people VALUES ('Margo', NULL, null);`, want: []model.Person{{Name: "Margo"}}},
+		{name: "double quotes", script: `INSERT INTO people VALUES ("Margo", "Ms.", "Privet!");`, want: []model.Person{margo}},
+		{
+			name:   "quoted semicolon and comment",
+			script: `INSERT INTO people VALUES ('Margo', 'Ms.', 'Privet; -- # hi');`,
+			want:   []model.Person{{Name: "Margo", Title: "Ms.", Description: "Privet; -- # hi"}},
+		},
+		{name: "backslash escape", script: `INSERT INTO people VALUES ('O\'Brien', 'Mr.', 'a \\ b');`, want: []model.Person{{Name: "O'Brien", Title: "Mr.", Description: `a \ b`}}},
+		{name: "doubled quote", script: `INSERT INTO people VALUES ('O''Brien', 'Mr.', 'it''s');`, want: []model.Person{{Name: "O'Brien", Title: "Mr.", Description: "it's"}}},
+		{
+			name:   "-- and # comments",
+			script: "-- the people\n# of the demo\nINSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!'); -- Margo\n",
+			want:   []model.Person{margo},
+		},
+		{
+			name:   "-- followed by a newline",
+			script: "--\nINSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!');\n--\tthe end\n--",
+			want:   []model.Person{margo},
+		},
+		{
+			name:   "other statements and tables are skipped",
+			script: "CREATE TABLE people (name VARCHAR(100));\nDELETE FROM people;\nINSERT INTO greetings VALUES ('Hello');\nINSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!');",
+			want:   []model.Person{margo},
+		},
+		{name: "empty", script: "\n;;\n-- nothing\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFixtures(strings.NewReader(tt.script))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != 0 || len(tt.want) != 0 {
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("expected %+v, got %+v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFixturesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{name: "unterminated string", script: `INSERT INTO people VALUES ('Margo, 'Ms.', 'Privet!);`},
+		{name: "unclosed tuple", script: `INSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!'`},
+		{name: "too few values", script: `INSERT INTO people VALUES ('Margo', 'Ms.');`},
+		{name: "too many values", script: `INSERT INTO people (name) VALUES ('Margo', 'Ms.');`},
+		{name: "no values", script: `INSERT INTO people SELECT * FROM others;`},
+		{name: "unclosed column list", script: `INSERT INTO people (name VALUES ('Margo');`},
+		{name: "unquoted value", script: `INSERT INTO people VALUES (Margo, 'Ms.', 'Privet!');`},
+		{name: "no table", script: `INSERT INTO`},
+		{name: "--x is not a comment", script: "--x\nINSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!');"},
+		{name: "not SQL", script: "'Margo', 'Ms.', 'Privet!'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if people, err := ParseFixtures(strings.NewReader(tt.script)); err == nil {
+				t.Errorf("expected an error, got %+v", people)
+			}
+		})
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	people, err := LoadFixtures("")
+	if err != nil {
+		t.Fatalf("failed to load the people of the migrations: %v", err)
+	}
+	if len(people) != 5 || people[3] != (model.Person{Name: "Margo", Title: "Ms.", Description: "Privet!"}) {
+		t.Errorf("expected the 5 people of the migrations, got %+v", people)
+	}
+
+	path := filepath.Join(t.TempDir(), "people.sql")
+	if err := ioutil.WriteFile(path, []byte(`INSERT INTO people VALUES ('Margo', 'Ms.', 'Privet!');`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if people, err := LoadFixtures(path); err != nil || len(people) != 1 {
+		t.Errorf("expected the person of the file, got %+v, %v", people, err)
+	}
+	if _, err := LoadFixtures(filepath.Join(t.TempDir(), "missing.sql")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
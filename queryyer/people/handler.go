@@ -0,0 +1,233 @@
+package people
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"medium-opentelemetry-poc/lib/model"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBodySize limits the JSON bodies of the requests, a person is a few hundred bytes
+const maxBodySize = 64 << 10
+
+// Handler serves the REST API of the people of store:
+//
+//	GET    /people         list all the people
+//	POST   /people         create a person (409 if the name is taken)
+//	GET    /people/{name}  get a person (404 if unknown)
+//	PUT    /people/{name}  replace the title and description of a person
+//	PATCH  /people/{name}  change only the fields given in the body
+//	DELETE /people/{name}  remove a person
+//
+// The bodies are the JSON of model.Person, validated with model.Person.Validate.
+type Handler struct {
+	store PersonStore
+}
+
+// NewHandler creates the Handler of the people of store, to be registered on both
+// /people and /people/.
+func NewHandler(store PersonStore) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer("queryyer-service").Start(r.Context(), "handlePeople")
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/people"), "/")
+	span.SetAttributes(semconv.HTTPMethodKey.String(r.Method))
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, r)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+		return
+	}
+
+	if strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	span.SetAttributes(personNameKey.String(name))
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, name)
+	case http.MethodPut:
+		h.replace(w, r, name)
+	case http.MethodPatch:
+		h.patch(w, r, name)
+	case http.MethodDelete:
+		h.delete(w, r, name)
+	default:
+		methodNotAllowed(w, "GET, PUT, PATCH, DELETE")
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	people, err := h.store.ListPeople(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, people)
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var p model.Person
+	if !decodeBody(w, r, &p) || !validate(w, r, p) {
+		return
+	}
+	if err := h.store.CreatePerson(r.Context(), p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/people/"+url.PathEscape(p.Name))
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, name string) {
+	p, err := h.store.GetPerson(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) replace(w http.ResponseWriter, r *http.Request, name string) {
+	var p model.Person
+	if !decodeBody(w, r, &p) {
+		return
+	}
+	// the name can be left out of the body, it's in the url
+	if p.Name == "" {
+		p.Name = name
+	}
+	if p.Name != name {
+		badRequest(w, r, errors.New("the name of the body doesn't match the url, a person can't be renamed"))
+		return
+	}
+	if !validate(w, r, p) {
+		return
+	}
+	if err := h.store.UpdatePerson(r.Context(), p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// personPatch is the body of PATCH, the fields left out are not changed
+type personPatch struct {
+	Name        *string
+	Title       *string
+	Description *string
+}
+
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, name string) {
+	var patch personPatch
+	if !decodeBody(w, r, &patch) {
+		return
+	}
+	if patch.Name != nil && *patch.Name != name {
+		badRequest(w, r, errors.New("the name of the body doesn't match the url, a person can't be renamed"))
+		return
+	}
+
+	p, err := h.store.GetPerson(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if patch.Title != nil {
+		p.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		p.Description = *patch.Description
+	}
+	if !validate(w, r, p) {
+		return
+	}
+	if err := h.store.UpdatePerson(r.Context(), p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, name string) {
+	if err := h.store.DeletePerson(r.Context(), name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeBody reads the JSON body into v, rejecting the unknown fields. It answers 400 and
+// returns false if the body is invalid.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		badRequest(w, r, errors.New("invalid JSON body: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+// validate answers 400 and returns false if p is not valid
+func validate(w http.ResponseWriter, r *http.Request, p model.Person) bool {
+	if err := p.Validate(); err != nil {
+		badRequest(w, r, err)
+		return false
+	}
+	return true
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	trace.SpanFromContext(r.Context()).RecordError(err)
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// writeError answers the error of the store: 404, 409, 503 or 500 (see StatusCode)
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	span := trace.SpanFromContext(r.Context())
+	span.RecordError(err)
+	status := StatusCode(err)
+	if status >= 500 {
+		span.SetStatus(codes.Error, "handlePeople-queryyer")
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
@@ -0,0 +1,103 @@
+package people
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+// notReadyStore is a store whose database is not reachable yet
+type notReadyStore struct {
+	*MemoryStore
+}
+
+func (notReadyStore) GetPerson(context.Context, string) (model.Person, error) {
+	return model.Person{}, fmt.Errorf("%w: dial tcp: connection refused", ErrNotReady)
+}
+
+func (notReadyStore) ListPeople(context.Context) ([]model.Person, error) {
+	return nil, fmt.Errorf("%w: dial tcp: connection refused", ErrNotReady)
+}
+
+func (notReadyStore) CreatePerson(context.Context, model.Person) error {
+	return fmt.Errorf("%w: dial tcp: connection refused", ErrNotReady)
+}
+
+func TestHandler(t *testing.T) {
+	long := strings.Repeat("x", model.MaxNameLength+1)
+	tests := []struct {
+		name       string
+		notReady   bool
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		// wantBody is in the body of the answer
+		wantBody string
+	}{
+		{name: "list", method: http.MethodGet, path: "/people", wantStatus: http.StatusOK, wantBody: `[{"Name":"Margo"`},
+		{name: "get", method: http.MethodGet, path: "/people/Margo", wantStatus: http.StatusOK, wantBody: `"Title":"Ms."`},
+		{name: "get an unknown person", method: http.MethodGet, path: "/people/Alice", wantStatus: http.StatusNotFound, wantBody: `person "Alice" not found`},
+		{name: "create", method: http.MethodPost, path: "/people", body: `{"Name": "Alice", "Title": "Dr."}`, wantStatus: http.StatusCreated, wantBody: `"Name":"Alice"`},
+		{name: "create a taken name", method: http.MethodPost, path: "/people", body: `{"Name": "Margo"}`, wantStatus: http.StatusConflict},
+		{name: "create without a name", method: http.MethodPost, path: "/people", body: `{"Title": "Dr."}`, wantStatus: http.StatusBadRequest, wantBody: "name is required"},
+		{name: "create a too long name", method: http.MethodPost, path: "/people", body: `{"Name": "` + long + `"}`, wantStatus: http.StatusBadRequest},
+		{name: "create with an unknown field", method: http.MethodPost, path: "/people", body: `{"Name": "Alice", "Age": 42}`, wantStatus: http.StatusBadRequest},
+		{name: "create with invalid JSON", method: http.MethodPost, path: "/people", body: `{"Name": `, wantStatus: http.StatusBadRequest},
+		{name: "replace", method: http.MethodPut, path: "/people/Margo", body: `{"Title": "Dr."}`, wantStatus: http.StatusOK, wantBody: `"Title":"Dr."`},
+		{name: "replace an unknown person", method: http.MethodPut, path: "/people/Alice", body: `{"Title": "Dr."}`, wantStatus: http.StatusNotFound},
+		{name: "rename", method: http.MethodPut, path: "/people/Margo", body: `{"Name": "Alice"}`, wantStatus: http.StatusBadRequest},
+		{name: "patch", method: http.MethodPatch, path: "/people/Margo", body: `{"Description": "Hi!"}`, wantStatus: http.StatusOK, wantBody: `"Title":"Ms.","Description":"Hi!"`},
+		{name: "patch an unknown person", method: http.MethodPatch, path: "/people/Alice", body: `{}`, wantStatus: http.StatusNotFound},
+		{name: "patch a too long title", method: http.MethodPatch, path: "/people/Margo", body: `{"Title": "` + long + `"}`, wantStatus: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, path: "/people/Margo", wantStatus: http.StatusNoContent},
+		{name: "delete an unknown person", method: http.MethodDelete, path: "/people/Alice", wantStatus: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPost, path: "/people/Margo", wantStatus: http.StatusMethodNotAllowed},
+		{name: "nested path", method: http.MethodGet, path: "/people/Margo/friends", wantStatus: http.StatusNotFound},
+		{name: "get while not ready", notReady: true, method: http.MethodGet, path: "/people/Margo", wantStatus: http.StatusServiceUnavailable},
+		{name: "list while not ready", notReady: true, method: http.MethodGet, path: "/people", wantStatus: http.StatusServiceUnavailable},
+		{name: "create while not ready", notReady: true, method: http.MethodPost, path: "/people", body: `{"Name": "Alice"}`, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var store PersonStore = NewMemoryStore(model.Person{Name: "Margo", Title: "Ms."})
+			if tt.notReady {
+				store = notReadyStore{NewMemoryStore()}
+			}
+			rec := httptest.NewRecorder()
+			NewHandler(store).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("expected %q in the body, got %q", tt.wantBody, rec.Body)
+			}
+			if retry := rec.Header().Get("Retry-After"); (retry != "") != (tt.wantStatus == http.StatusServiceUnavailable) {
+				t.Errorf("expected Retry-After with the 503 only, got %q", retry)
+			}
+		})
+	}
+}
+
+func TestHandlerCreateSetsTheLocation(t *testing.T) {
+	store := NewMemoryStore()
+	rec := httptest.NewRecorder()
+	NewHandler(store).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/people", strings.NewReader(`{"Name": "Jean Luc"}`)))
+	if got := rec.Header().Get("Location"); got != "/people/Jean%20Luc" {
+		t.Errorf("expected the location of the person, got %q", got)
+	}
+	var p model.Person
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Name != "Jean Luc" {
+		t.Errorf("expected the created person, got %s", rec.Body)
+	}
+	if _, err := store.GetPerson(context.Background(), "Jean Luc"); err != nil {
+		t.Errorf("expected the person to be stored, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package people
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"medium-opentelemetry-poc/lib/model"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// storeSystemKey tells which backend answered, on the spans of the stores without a database
+const storeSystemKey = attribute.Key("people.store")
+
+// MemoryStore is a PersonStore keeping the people in memory, safe for concurrent use.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	people map[string]model.Person
+	// backend is recorded on the spans, FileStore is a MemoryStore as well
+	backend string
+	// onChange is called with the lock held after every modification, the modification
+	// is reverted if it fails (FileStore writes the file there)
+	onChange func() error
+}
+
+// NewMemoryStore creates a MemoryStore holding people.
+func NewMemoryStore(people ...model.Person) *MemoryStore {
+	s := &MemoryStore{people: make(map[string]model.Person, len(people)), backend: StoreMemory}
+	for _, p := range people {
+		s.people[p.Name] = p
+	}
+	return s
+}
+
+// startSpan starts the span of an operation of the store
+func (s *MemoryStore) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := otel.Tracer("repository").Start(ctx, name)
+	span.SetAttributes(storeSystemKey.String(s.backend))
+	span.SetAttributes(attrs...)
+	return span
+}
+
+// GetPerson finds the person in memory by name, a NotFoundError if there is none.
+func (s *MemoryStore) GetPerson(ctx context.Context, name string) (model.Person, error) {
+	span := s.startSpan(ctx, "GetPerson-function", personNameKey.String(name))
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.people[name]; ok {
+		return p, nil
+	}
+	err := &NotFoundError{Name: name}
+	recordStoreError(span, err)
+	return model.Person{}, err
+}
+
+// GetPeople finds the people in memory by name, the unknown names are left out of the map.
+func (s *MemoryStore) GetPeople(ctx context.Context, names []string) (map[string]model.Person, error) {
+	span := s.startSpan(ctx, "GetPeople-function", batchSizeKey.Int(len(names)))
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	people := make(map[string]model.Person, len(names))
+	for _, name := range names {
+		if p, ok := s.people[name]; ok {
+			people[name] = p
+		}
+	}
+	span.SetAttributes(peopleCountKey.Int(len(people)))
+	return people, nil
+}
+
+// ListPeople returns all the people, sorted by name.
+func (s *MemoryStore) ListPeople(ctx context.Context) ([]model.Person, error) {
+	span := s.startSpan(ctx, "ListPeople-function")
+	defer span.End()
+
+	s.mu.RLock()
+	people := make([]model.Person, 0, len(s.people))
+	for _, p := range s.people {
+		people = append(people, p)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(people, func(i, j int) bool { return people[i].Name < people[j].Name })
+	span.SetAttributes(peopleCountKey.Int(len(people)))
+	return people, nil
+}
+
+// CreatePerson adds p, ErrConflict if its name is already taken.
+func (s *MemoryStore) CreatePerson(ctx context.Context, p model.Person) error {
+	span := s.startSpan(ctx, "CreatePerson-function", personNameKey.String(p.Name))
+	defer span.End()
+
+	err := s.modify(p.Name, func(old model.Person, exists bool) (*model.Person, error) {
+		if exists {
+			return nil, ErrConflict
+		}
+		return &p, nil
+	})
+	recordStoreError(span, err)
+	return err
+}
+
+// UpdatePerson replaces the person named p.Name by p, ErrNotFound if there is none.
+func (s *MemoryStore) UpdatePerson(ctx context.Context, p model.Person) error {
+	span := s.startSpan(ctx, "UpdatePerson-function", personNameKey.String(p.Name))
+	defer span.End()
+
+	err := s.modify(p.Name, func(old model.Person, exists bool) (*model.Person, error) {
+		if !exists {
+			return nil, &NotFoundError{Name: p.Name}
+		}
+		return &p, nil
+	})
+	recordStoreError(span, err)
+	return err
+}
+
+// DeletePerson removes the person by name, ErrNotFound if there is none.
+func (s *MemoryStore) DeletePerson(ctx context.Context, name string) error {
+	span := s.startSpan(ctx, "DeletePerson-function", personNameKey.String(name))
+	defer span.End()
+
+	err := s.modify(name, func(old model.Person, exists bool) (*model.Person, error) {
+		if !exists {
+			return nil, &NotFoundError{Name: name}
+		}
+		return nil, nil
+	})
+	recordStoreError(span, err)
+	return err
+}
+
+// modify replaces the person by name with the one returned by change (nil deletes it),
+// then calls onChange. Everything is done with the lock held, so the modifications and
+// the writes of the file happen in the same order.
+func (s *MemoryStore) modify(name string, change func(old model.Person, exists bool) (*model.Person, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.people[name]
+	p, err := change(old, exists)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		s.people[name] = *p
+	} else {
+		delete(s.people, name)
+	}
+
+	if s.onChange == nil {
+		return nil
+	}
+	if err := s.onChange(); err != nil {
+		// revert, so the memory stays what has been saved
+		if exists {
+			s.people[name] = old
+		} else {
+			delete(s.people, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Ready implements PersonStore, the memory is always ready.
+func (s *MemoryStore) Ready() error {
+	return nil
+}
+
+// Close implements PersonStore, there is nothing to release.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// recordStoreError marks the span as failed, except for ErrNotFound and ErrConflict which are
+// answers of the store (the http handler turns them into 404/409)
+func recordStoreError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	if !isClientError(err) {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+package people
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"medium-opentelemetry-poc/lib/model"
+)
+
+var (
+	margo  = model.Person{Name: "Margo", Title: "Ms.", Description: "Privet!"}
+	farhad = model.Person{Name: "Farhad", Title: "Dr.", Description: "Why ... why are you so nice?"}
+)
+
+func TestMemoryStoreGet(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(margo, farhad)
+
+	if p, err := store.GetPerson(ctx, "Margo"); err != nil || p != margo {
+		t.Errorf("expected %+v, got %+v, %v", margo, p, err)
+	}
+	_, err := store.GetPerson(ctx, "Alice")
+	var notFound *NotFoundError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &notFound) || notFound.Name != "Alice" {
+		t.Errorf("expected a NotFoundError of Alice, got %v", err)
+	}
+
+	people, err := store.GetPeople(ctx, []string{"Margo", "Alice", "Farhad"})
+	if err != nil || !reflect.DeepEqual(people, map[string]model.Person{"Margo": margo, "Farhad": farhad}) {
+		t.Errorf("expected the known people only, got %+v, %v", people, err)
+	}
+	list, err := store.ListPeople(ctx)
+	if err != nil || !reflect.DeepEqual(list, []model.Person{farhad, margo}) {
+		t.Errorf("expected the people sorted by name, got %+v, %v", list, err)
+	}
+}
+
+func TestMemoryStoreModify(t *testing.T) {
+	ctx := context.Background()
+	alice := model.Person{Name: "Alice", Title: "Dr."}
+	tests := []struct {
+		name    string
+		modify  func(*MemoryStore) error
+		wantErr error
+		want    []model.Person
+	}{
+		{name: "create", modify: func(s *MemoryStore) error { return s.CreatePerson(ctx, alice) }, want: []model.Person{alice, margo}},
+		{name: "create a taken name", modify: func(s *MemoryStore) error { return s.CreatePerson(ctx, margo) }, wantErr: ErrConflict, want: []model.Person{margo}},
+		{name: "update", modify: func(s *MemoryStore) error { return s.UpdatePerson(ctx, model.Person{Name: "Margo"}) }, want: []model.Person{{Name: "Margo"}}},
+		{name: "update an unknown person", modify: func(s *MemoryStore) error { return s.UpdatePerson(ctx, alice) }, wantErr: ErrNotFound, want: []model.Person{margo}},
+		{name: "delete", modify: func(s *MemoryStore) error { return s.DeletePerson(ctx, "Margo") }, want: []model.Person{}},
+		{name: "delete an unknown person", modify: func(s *MemoryStore) error { return s.DeletePerson(ctx, "Alice") }, wantErr: ErrNotFound, want: []model.Person{margo}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore(margo)
+			if err := tt.modify(store); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if list, _ := store.ListPeople(ctx); !reflect.DeepEqual(list, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, list)
+			}
+		})
+
+		if tt.wantErr != nil {
+			continue
+		}
+		t.Run(tt.name+" reverted when it can't be saved", func(t *testing.T) {
+			store := NewMemoryStore(margo)
+			errSave := errors.New("disk full")
+			store.onChange = func() error { return errSave }
+			if err := tt.modify(store); !errors.Is(err, errSave) {
+				t.Fatalf("expected the error of the save, got %v", err)
+			}
+			if list, _ := store.ListPeople(ctx); !reflect.DeepEqual(list, []model.Person{margo}) {
+				t.Errorf("expected the modification to be reverted, got %+v", list)
+			}
+		})
+	}
+}
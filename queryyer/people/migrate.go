@@ -0,0 +1,170 @@
+package people
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// migrationsFS holds the migrations of the people database, named <version>_<name>.sql.
+// They are forward only: a migration is never changed once released, a new one is added instead.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// The attributes of the spans of the migrations
+const (
+	migrationVersionKey = attribute.Key("migration.version")
+	migrationNameKey    = attribute.Key("migration.name")
+	schemaVersionKey    = attribute.Key("schema.version")
+)
+
+// migrationsLock is the MySQL named lock taken while migrating, so the replicas of queryyer
+// starting together don't apply the same migration twice
+const migrationsLock = "queryyer_people_migrations"
+
+// Migration is a step of the schema of the people database.
+type Migration struct {
+	Version int
+	Name    string
+	// Statements are run one after the other (MySQL runs one statement per call)
+	Statements []string
+}
+
+// Migrations returns the migrations embedded in queryyer, sorted by version.
+func Migrations() ([]Migration, error) {
+	files, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(files))
+	for _, f := range files {
+		parts := strings.SplitN(strings.TrimSuffix(f.Name(), ".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<name>.sql", f.Name())
+		}
+		script, err := migrationsFS.ReadFile(path.Join("migrations", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{
+			Version:    version,
+			Name:       parts[1],
+			Statements: splitStatements(string(script)),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("two migrations with version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies the migrations which are not in the schema_version table yet, in order.
+// Every migration has its own span, and every statement its own child span (otelsql).
+func (r *Repository) Migrate(ctx context.Context) error {
+	ctx, span := otel.Tracer("repository").Start(ctx, "Migrate")
+	defer span.End()
+
+	err := r.migrate(ctx, span)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "migration failed")
+	}
+	return err
+}
+
+func (r *Repository) migrate(ctx context.Context, span trace.Span) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	// the named lock belongs to the connection, all the migration runs on this one
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "select get_lock(?, 60)", migrationsLock).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("cannot take the lock %q, another queryyer is migrating the database", migrationsLock)
+	}
+	defer conn.ExecContext(context.Background(), "select release_lock(?)", migrationsLock)
+
+	_, err = conn.ExecContext(ctx, `create table if not exists schema_version (
+		version    INT PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	var current sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "select max(version) from schema_version").Scan(&current); err != nil {
+		return err
+	}
+	span.SetAttributes(schemaVersionKey.Int64(current.Int64))
+
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	if int(current.Int64) > latest {
+		// forward only, an older queryyer doesn't know how to undo the newer migrations
+		return fmt.Errorf("the schema version of the database (%d) is newer than the migrations of queryyer (%d)", current.Int64, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= int(current.Int64) {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return err
+		}
+		span.SetAttributes(schemaVersionKey.Int(m.Version))
+	}
+	return nil
+}
+
+// applyMigration runs the statements of m then records it in schema_version.
+// MySQL commits the schema changes right away (no transaction), so the statements of a
+// migration have to be safe to run again if it fails in the middle (IF NOT EXISTS, INSERT IGNORE...).
+func applyMigration(ctx context.Context, conn *sql.Conn, m Migration) error {
+	ctx, span := otel.Tracer("repository").Start(ctx, fmt.Sprintf("migration %04d_%s", m.Version, m.Name),
+		trace.WithAttributes(migrationVersionKey.Int(m.Version), migrationNameKey.String(m.Name)))
+	defer span.End()
+
+	for _, stmt := range m.Statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			err = fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "migration failed")
+			return err
+		}
+	}
+	_, err := conn.ExecContext(ctx, "insert into schema_version (version, name) values (?, ?)", m.Version, m.Name)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "migration failed")
+		return err
+	}
+	return nil
+}
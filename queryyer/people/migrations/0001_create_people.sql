@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS people (
+    name        VARCHAR(100),
+    title       VARCHAR(10),
+    description VARCHAR(100),
+    PRIMARY KEY (name)
+);
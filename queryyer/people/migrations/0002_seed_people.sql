@@ -0,0 +1,6 @@
+-- the people of the demo, kept if they are already there (databases created by db/database.sql)
+INSERT IGNORE INTO people VALUES ('EQ', 'Tech', 'Where are the cakes?');
+INSERT IGNORE INTO people VALUES ('Farhad', 'Dr.', 'Why ... why are you so nice?');
+INSERT IGNORE INTO people VALUES ('Sonos', 'Mr.', 'you are so loud!');
+INSERT IGNORE INTO people VALUES ('Margo', 'Ms.', 'Privet!');
+INSERT IGNORE INTO people VALUES ('Trace', 'Mr.', 'This is so cool!');
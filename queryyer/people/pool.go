@@ -0,0 +1,44 @@
+package people
+
+import (
+	"database/sql"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+)
+
+// PoolConfig tunes the connection pool of the MySQL database.
+type PoolConfig struct {
+	// MaxOpenConns limits the connections opened to the database (in use + idle),
+	// the queries wait for a free connection beyond that. 0 is unlimited.
+	MaxOpenConns int
+	// MaxIdleConns is how many connections are kept open when they are not used
+	MaxIdleConns int
+	// ConnMaxLifetime closes the connections after this long, it should be shorter than
+	// the wait_timeout of MySQL (and of any proxy in between). 0 keeps them forever.
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig is used for the settings which are not in the environment variables
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    10,
+	MaxIdleConns:    10,
+	ConnMaxLifetime: 3 * time.Minute,
+}
+
+// PoolConfigFromEnv returns the PoolConfig set in MYSQL_MAX_OPEN_CONNS, MYSQL_MAX_IDLE_CONNS
+// and MYSQL_CONN_MAX_LIFETIME (e.g. "3m").
+func PoolConfigFromEnv() PoolConfig {
+	cfg := DefaultPoolConfig
+	cfg.MaxOpenConns = env.Int("MYSQL_MAX_OPEN_CONNS", cfg.MaxOpenConns)
+	cfg.MaxIdleConns = env.Int("MYSQL_MAX_IDLE_CONNS", cfg.MaxIdleConns)
+	cfg.ConnMaxLifetime = env.Duration("MYSQL_CONN_MAX_LIFETIME", cfg.ConnMaxLifetime)
+	return cfg
+}
+
+// apply sets the pool settings on db
+func (cfg PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+}
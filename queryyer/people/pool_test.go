@@ -0,0 +1,67 @@
+package people
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+// setenv sets key for the test, unsets it if value is empty (t.Setenv needs go 1.17)
+func setenv(t *testing.T, key, value string) {
+	old, had := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestPoolConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name                      string
+		maxOpen, maxIdle, maxLife string
+		want                      PoolConfig
+	}{
+		{name: "defaults", want: DefaultPoolConfig},
+		{
+			name: "all set", maxOpen: "50", maxIdle: "5", maxLife: "30s",
+			want: PoolConfig{MaxOpenConns: 50, MaxIdleConns: 5, ConnMaxLifetime: 30 * time.Second},
+		},
+		{
+			name: "unlimited", maxOpen: "0", maxLife: "0s",
+			want: PoolConfig{MaxOpenConns: 0, MaxIdleConns: DefaultPoolConfig.MaxIdleConns, ConnMaxLifetime: 0},
+		},
+		{name: "invalid values are ignored", maxOpen: "many", maxIdle: "1.5", maxLife: "3", want: DefaultPoolConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "MYSQL_MAX_OPEN_CONNS", tt.maxOpen)
+			setenv(t, "MYSQL_MAX_IDLE_CONNS", tt.maxIdle)
+			setenv(t, "MYSQL_CONN_MAX_LIFETIME", tt.maxLife)
+			if got := PoolConfigFromEnv(); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPoolConfigApply(t *testing.T) {
+	// sql.Open doesn't connect, the settings of the pool can be read from its stats
+	db, err := sql.Open("mysql", "user:password@tcp(localhost:3306)/people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	PoolConfig{MaxOpenConns: 7, MaxIdleConns: 2, ConnMaxLifetime: time.Minute}.apply(db)
+	if got := db.Stats().MaxOpenConnections; got != 7 {
+		t.Errorf("expected 7 max open connections, got %d", got)
+	}
+}
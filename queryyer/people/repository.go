@@ -3,59 +3,183 @@ package people
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
 
+	"medium-opentelemetry-poc/lib/env"
 	"medium-opentelemetry-poc/lib/model"
+	"medium-opentelemetry-poc/lib/otelsql"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
-	}
-	return value
-}
+// mysqlErrDupEntry is the error of MySQL when inserting a duplicate primary key
+const mysqlErrDupEntry = 1062
 
-// Repository retrieves information about people.
+// Repository is the PersonStore backed by the MySQL database.
 type Repository struct {
 	db *sql.DB
+
+	// mu guards readyErr, which is nil once the database is reachable (and migrated)
+	mu       sync.RWMutex
+	readyErr error
+	// done is closed when the repository is ready or gave up connecting
+	done chan struct{}
+	// cancel stops connecting when the repository is closed
+	cancel context.CancelFunc
 }
 
-// NewRepository creates a new Repository backed by MySQL database.
-func NewRepository() *Repository {
-	dburl := getenv("MYSQL_URL", "root:mysqlpwd@tcp(127.0.0.1:3306)/sampleDB")
-	log.Print("dbURL=" + dburl)
-	db, err := sql.Open("mysql", dburl)
+// NewRepository creates a new Repository backed by the MySQL database of MYSQL_URL.
+// It returns right away and connects in the background, retrying until the database is up
+// (see RetryConfigFromEnv), then applies the pending migrations unless MIGRATE_ON_START is false.
+// Until then the repository is not ready: Ready and every operation return ErrNotReady.
+func NewRepository() (*Repository, error) {
+	r, err := openRepository()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	err = db.Ping()
+	migrate := env.Get("MIGRATE_ON_START", "true") != "false"
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go func() {
+		err := r.connect(ctx, RetryConfigFromEnv())
+		if err == nil && migrate {
+			err = r.Migrate(ctx)
+		}
+		r.setReady(err)
+	}()
+	return r, nil
+}
+
+// OpenRepository opens the MySQL database of MYSQL_URL as it is, without migrating it.
+// It waits for the database like NewRepository does, and fails if it's still down after
+// the max wait.
+func OpenRepository() (*Repository, error) {
+	r, err := openRepository()
 	if err != nil {
-		log.Fatalf("Cannot ping the db: %v", err)
+		return nil, err
+	}
+	err = r.connect(context.Background(), RetryConfigFromEnv())
+	r.setReady(err)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func openRepository() (*Repository, error) {
+	dburl := env.Get("MYSQL_URL", "root:mysqlpwd@tcp(127.0.0.1:3306)/sampleDB")
+	log.Print("dbURL=" + dburl)
+	// every query, exec, prepare and transaction gets its own span
+	attrs := mysqlAttributes(dburl)
+	db, err := otelsql.Open("mysql", dburl, attrs...)
+	if err != nil {
+		return nil, err
+	}
+	pool := PoolConfigFromEnv()
+	log.Printf("pool: max open=%d, max idle=%d, max lifetime=%s", pool.MaxOpenConns, pool.MaxIdleConns, pool.ConnMaxLifetime)
+	pool.apply(db)
+	// publish sql.DBStats, to tell when slow queries are in fact waiting for a connection
+	if err := otelsql.RecordStats(db, attrs...); err != nil {
+		log.Printf("cannot record the stats of the pool: %v", err)
 	}
 	return &Repository{
-		db: db,
+		db:       db,
+		readyErr: ErrNotReady,
+		done:     make(chan struct{}),
+		cancel:   func() {},
+	}, nil
+}
+
+// setReady records the outcome of connecting to the database, err is nil if it's reachable
+func (r *Repository) setReady(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		log.Printf("the db is not usable: %v", err)
+		r.readyErr = fmt.Errorf("%w: %v", ErrNotReady, err)
+	} else {
+		log.Print("the db is ready")
+		r.readyErr = nil
+	}
+	close(r.done)
+}
+
+// Ready returns nil once the database is reachable and migrated, an ErrNotReady otherwise.
+func (r *Repository) Ready() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.readyErr
+}
+
+// WaitReady blocks until the repository is ready or gave up connecting to the database,
+// it returns the error of Ready then.
+func (r *Repository) WaitReady(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.Ready()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mysqlAttributes describes the database of dsn in the spans of the queries
+func mysqlAttributes(dsn string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.DBSystemMySQL}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		// sql.Open fails with the same error anyway
+		return attrs
+	}
+	if cfg.DBName != "" {
+		attrs = append(attrs, semconv.DBNameKey.String(cfg.DBName))
+	}
+	if cfg.User != "" {
+		attrs = append(attrs, semconv.DBUserKey.String(cfg.User))
+	}
+	if host, port, err := net.SplitHostPort(cfg.Addr); err == nil {
+		attrs = append(attrs, semconv.NetPeerNameKey.String(host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.NetPeerPortKey.Int(p))
+		}
+	} else if cfg.Addr != "" {
+		attrs = append(attrs, semconv.NetPeerNameKey.String(cfg.Addr))
 	}
+	return attrs
 }
 
-// GetPerson tries to find the person in the database by name.
-// If not found, it still returns a Person object with only name
-// field populated.
+// startSpan starts the span of an operation of the repository, the calls to the database
+// (otelsql) are its children
+func (r *Repository) startSpan(ctx context.Context, name, query string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer("repository").Start(ctx, name)
+	span.SetAttributes(semconv.DBSystemMySQL, semconv.DBStatementKey.String(query))
+	span.SetAttributes(attrs...)
+	return ctx, span
+}
+
+// GetPerson tries to find the person in the database by name, a NotFoundError if there is none.
 func (r *Repository) GetPerson(ctx context.Context, name string) (model.Person, error) {
-	ctx, span := otel.Tracer("repository").Start(ctx, "GetPerson-function")
+	if err := r.Ready(); err != nil {
+		return model.Person{}, err
+	}
+	query := "select title, description from people where name = ?"
+	ctx, span := r.startSpan(ctx, "GetPerson-function", query, personNameKey.String(name))
 	defer span.End()
 	span.AddEvent("Repository event!")
 
-	query := "select title, description from people where name = ?"
-	span.SetAttributes(attribute.Key("Query").String(query))
-
 	rows, err := r.db.QueryContext(ctx, query, name)
 	if err != nil {
+		recordStoreError(span, err)
 		return model.Person{}, err
 	}
 	defer rows.Close()
@@ -64,6 +188,7 @@ func (r *Repository) GetPerson(ctx context.Context, name string) (model.Person,
 		var title, descr string
 		err := rows.Scan(&title, &descr)
 		if err != nil {
+			recordStoreError(span, err)
 			return model.Person{}, err
 		}
 		return model.Person{
@@ -72,12 +197,184 @@ func (r *Repository) GetPerson(ctx context.Context, name string) (model.Person,
 			Description: descr,
 		}, nil
 	}
-	return model.Person{
-		Name: name,
-	}, nil
+	if err := rows.Err(); err != nil {
+		recordStoreError(span, err)
+		return model.Person{}, err
+	}
+	err = &NotFoundError{Name: name}
+	recordStoreError(span, err)
+	return model.Person{}, err
+}
+
+// GetPeople finds the people in the database by name with a single query,
+// the unknown names are left out of the map.
+func (r *Repository) GetPeople(ctx context.Context, names []string) (map[string]model.Person, error) {
+	if err := r.Ready(); err != nil {
+		return nil, err
+	}
+	people := make(map[string]model.Person, len(names))
+	if len(names) == 0 {
+		return people, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	query := "select name, title, description from people where name in (" + placeholders + ")"
+	ctx, span := r.startSpan(ctx, "GetPeople-function", query, batchSizeKey.Int(len(names)))
+	defer span.End()
+
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		recordStoreError(span, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	// the collation of the table is case insensitive, like GetPerson we answer with the
+	// names as they were asked for
+	found := make(map[string]model.Person, len(names))
+	for rows.Next() {
+		var p model.Person
+		if err := rows.Scan(&p.Name, &p.Title, &p.Description); err != nil {
+			recordStoreError(span, err)
+			return nil, err
+		}
+		found[strings.ToLower(p.Name)] = p
+	}
+	if err := rows.Err(); err != nil {
+		recordStoreError(span, err)
+		return nil, err
+	}
+	for _, name := range names {
+		if p, ok := found[strings.ToLower(name)]; ok {
+			p.Name = name
+			people[name] = p
+		}
+	}
+	span.SetAttributes(peopleCountKey.Int(len(people)))
+	return people, nil
+}
+
+// CaseInsensitive tells the CachedStore that the names are matched whatever their case,
+// like the collation of the table.
+func (r *Repository) CaseInsensitive() bool {
+	return true
+}
+
+// ListPeople returns all the people of the database, sorted by name.
+func (r *Repository) ListPeople(ctx context.Context) ([]model.Person, error) {
+	if err := r.Ready(); err != nil {
+		return nil, err
+	}
+	query := "select name, title, description from people order by name"
+	ctx, span := r.startSpan(ctx, "ListPeople-function", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		recordStoreError(span, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []model.Person{}
+	for rows.Next() {
+		var p model.Person
+		if err := rows.Scan(&p.Name, &p.Title, &p.Description); err != nil {
+			recordStoreError(span, err)
+			return nil, err
+		}
+		people = append(people, p)
+	}
+	if err := rows.Err(); err != nil {
+		recordStoreError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(peopleCountKey.Int(len(people)))
+	return people, nil
+}
+
+// CreatePerson inserts p, ErrConflict if its name is already taken.
+func (r *Repository) CreatePerson(ctx context.Context, p model.Person) error {
+	if err := r.Ready(); err != nil {
+		return err
+	}
+	query := "insert into people (name, title, description) values (?, ?, ?)"
+	ctx, span := r.startSpan(ctx, "CreatePerson-function", query, personNameKey.String(p.Name))
+	defer span.End()
+
+	_, err := r.db.ExecContext(ctx, query, p.Name, p.Title, p.Description)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupEntry {
+		err = ErrConflict
+	}
+	recordStoreError(span, err)
+	return err
+}
+
+// UpdatePerson replaces the title and the description of the person named p.Name,
+// ErrNotFound if there is none.
+func (r *Repository) UpdatePerson(ctx context.Context, p model.Person) error {
+	if err := r.Ready(); err != nil {
+		return err
+	}
+	query := "update people set title = ?, description = ? where name = ?"
+	ctx, span := r.startSpan(ctx, "UpdatePerson-function", query, personNameKey.String(p.Name))
+	defer span.End()
+
+	res, err := r.db.ExecContext(ctx, query, p.Title, p.Description, p.Name)
+	if err == nil {
+		err = r.checkAffected(ctx, res, p.Name)
+	}
+	recordStoreError(span, err)
+	return err
+}
+
+// DeletePerson removes the person by name, ErrNotFound if there is none.
+func (r *Repository) DeletePerson(ctx context.Context, name string) error {
+	if err := r.Ready(); err != nil {
+		return err
+	}
+	query := "delete from people where name = ?"
+	ctx, span := r.startSpan(ctx, "DeletePerson-function", query, personNameKey.String(name))
+	defer span.End()
+
+	res, err := r.db.ExecContext(ctx, query, name)
+	if err == nil {
+		err = r.checkAffected(ctx, res, name)
+	}
+	recordStoreError(span, err)
+	return err
+}
+
+// checkAffected returns a NotFoundError when no row was affected by res and there is no person by name.
+// MySQL doesn't count the rows updated with the values they already had, so we have to look
+// the person up to tell.
+func (r *Repository) checkAffected(ctx context.Context, res sql.Result, name string) error {
+	affected, err := res.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	var exists int
+	err = r.db.QueryRowContext(ctx, "select 1 from people where name = ?", name).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &NotFoundError{Name: name}
+	}
+	return err
+}
+
+// Ping checks the database answers, it is not traced since it's used by the health checks.
+func (r *Repository) Ping(ctx context.Context) error {
+	if err := r.Ready(); err != nil {
+		return err
+	}
+	return r.db.PingContext(otelsql.WithoutTracing(ctx))
 }
 
 // Close calls close on the underlying db connection.
-func (r *Repository) Close() {
-	r.db.Close()
+func (r *Repository) Close() error {
+	r.cancel()
+	return r.db.Close()
 }
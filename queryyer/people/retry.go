@@ -0,0 +1,117 @@
+package people
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+	"medium-opentelemetry-poc/lib/random"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryConfig tells how long to wait for the database when queryyer starts.
+type RetryConfig struct {
+	// InitialBackoff is the wait after the first failed attempt, it doubles after every
+	// attempt up to MaxBackoff. A random jitter (up to half of it) is taken off, so the
+	// replicas starting together don't hammer the database in sync.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxWait is how long we try before giving up, 0 tries forever
+	MaxWait time.Duration
+	// AttemptTimeout limits every attempt (ping)
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryConfig is used for the settings which are not in the environment variables
+var DefaultRetryConfig = RetryConfig{
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	MaxWait:        2 * time.Minute,
+	AttemptTimeout: 5 * time.Second,
+}
+
+// RetryConfigFromEnv returns the RetryConfig set in DB_CONNECT_INITIAL_BACKOFF, DB_CONNECT_MAX_BACKOFF,
+// DB_CONNECT_MAX_WAIT and DB_CONNECT_ATTEMPT_TIMEOUT (e.g. "500ms", "2m").
+func RetryConfigFromEnv() RetryConfig {
+	cfg := DefaultRetryConfig
+	cfg.InitialBackoff = env.Duration("DB_CONNECT_INITIAL_BACKOFF", cfg.InitialBackoff)
+	cfg.MaxBackoff = env.Duration("DB_CONNECT_MAX_BACKOFF", cfg.MaxBackoff)
+	cfg.MaxWait = env.Duration("DB_CONNECT_MAX_WAIT", cfg.MaxWait)
+	cfg.AttemptTimeout = env.Duration("DB_CONNECT_ATTEMPT_TIMEOUT", cfg.AttemptTimeout)
+	return cfg
+}
+
+// The attributes of the spans of the connection attempts
+const (
+	attemptKey  = attribute.Key("db.connect.attempt")
+	backoffKey  = attribute.Key("db.connect.backoff_ms")
+	attemptsKey = attribute.Key("db.connect.attempts")
+)
+
+// connect pings the database until it answers, retrying with an exponential backoff.
+// It gives up when ctx is done or after cfg.MaxWait.
+// Every attempt has its own span under ConnectDB.
+func (r *Repository) connect(ctx context.Context, cfg RetryConfig) error {
+	ctx, span := otel.Tracer("repository").Start(ctx, "ConnectDB")
+	defer span.End()
+
+	start := time.Now()
+	backoff := cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := r.ping(ctx, attempt, cfg.AttemptTimeout)
+		if err == nil {
+			span.SetAttributes(attemptsKey.Int(attempt))
+			return nil
+		}
+
+		delay := random.Jitter(backoff)
+		if remaining := cfg.MaxWait - time.Since(start); cfg.MaxWait > 0 && delay > remaining {
+			// one last attempt at the deadline
+			delay = remaining
+		}
+		if cfg.MaxWait > 0 && delay <= 0 {
+			err = fmt.Errorf("cannot connect to the db after %d attempts in %s: %w", attempt, time.Since(start).Round(time.Millisecond), err)
+			span.SetAttributes(attemptsKey.Int(attempt))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "cannot connect to the db")
+			return err
+		}
+		log.Printf("cannot ping the db (attempt %d), retrying in %s: %v", attempt, delay.Round(time.Millisecond), err)
+		span.AddEvent("retrying", trace.WithAttributes(attemptKey.Int(attempt), backoffKey.Int64(delay.Milliseconds())))
+
+		select {
+		case <-ctx.Done():
+			span.RecordError(ctx.Err())
+			span.SetStatus(codes.Error, "cannot connect to the db")
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if backoff *= 2; backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+// ping is an attempt of connect
+func (r *Repository) ping(ctx context.Context, attempt int, timeout time.Duration) error {
+	ctx, span := otel.Tracer("repository").Start(ctx, "ConnectDB-attempt", trace.WithAttributes(attemptKey.Int(attempt)))
+	defer span.End()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := r.db.PingContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "ping failed")
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package people
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"medium-opentelemetry-poc/lib/env"
+	"medium-opentelemetry-poc/lib/model"
+)
+
+// PersonStore retrieves information about people.
+// Repository (MySQL), MemoryStore and FileStore implement it.
+type PersonStore interface {
+	// GetPerson finds the person by name, a NotFoundError (errors.Is ErrNotFound) if there is none.
+	GetPerson(ctx context.Context, name string) (model.Person, error)
+	// GetPeople finds the people by name at once, the unknown names are left out of the map.
+	GetPeople(ctx context.Context, names []string) (map[string]model.Person, error)
+	// ListPeople returns all the people, sorted by name.
+	ListPeople(ctx context.Context) ([]model.Person, error)
+	// CreatePerson adds p, ErrConflict if its name is already taken.
+	CreatePerson(ctx context.Context, p model.Person) error
+	// UpdatePerson replaces the person named p.Name by p, ErrNotFound if there is none.
+	UpdatePerson(ctx context.Context, p model.Person) error
+	// DeletePerson removes the person by name, ErrNotFound if there is none.
+	DeletePerson(ctx context.Context, name string) error
+	// Ready returns nil when the store can be used, an ErrNotReady otherwise
+	Ready() error
+	// Close releases the resources of the store (connections, files...)
+	Close() error
+}
+
+// Check is the health check of store: it must be ready, and its database must answer if it has one.
+func Check(ctx context.Context, store PersonStore) error {
+	if cached, ok := store.(*CachedStore); ok {
+		store = cached.PersonStore
+	}
+	if pinger, ok := store.(interface{ Ping(context.Context) error }); ok {
+		return pinger.Ping(ctx)
+	}
+	return store.Ready()
+}
+
+// WaitReady blocks until store is ready, or can't become ready (the Repository gave up
+// connecting to the database), it returns the error of Ready then.
+func WaitReady(ctx context.Context, store PersonStore) error {
+	if cached, ok := store.(*CachedStore); ok {
+		store = cached.PersonStore
+	}
+	if waiter, ok := store.(interface{ WaitReady(context.Context) error }); ok {
+		return waiter.WaitReady(ctx)
+	}
+	return store.Ready()
+}
+
+// The backends accepted by PEOPLE_STORE
+const (
+	// StoreMySQL is the MySQL database of MYSQL_URL (default)
+	StoreMySQL = "mysql"
+	// StoreMemory keeps the people in memory, seeded from the PEOPLE_FIXTURES file
+	// (default: the people inserted by the migrations).
+	// Nothing to run next to queryyer, handy for the local runs and the tests.
+	StoreMemory = "memory"
+	// StoreFile keeps the people in the JSON file PEOPLE_STORE_PATH, seeded from the
+	// PEOPLE_FIXTURES file when it does not exist yet
+	StoreFile = "file"
+)
+
+// The default size and expiration of the cache in front of the store
+const (
+	DefaultCacheSize = 1000
+	DefaultCacheTTL  = 30 * time.Second
+)
+
+// NewStoreFromEnv opens the PersonStore selected by PEOPLE_STORE, behind an LRUCache
+// of PEOPLE_CACHE_SIZE people (0 disables it) which expire after PEOPLE_CACHE_TTL.
+func NewStoreFromEnv() (PersonStore, error) {
+	store, err := newBackendFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	size := env.Int("PEOPLE_CACHE_SIZE", DefaultCacheSize)
+	if size <= 0 {
+		return store, nil
+	}
+	ttl := env.Duration("PEOPLE_CACHE_TTL", DefaultCacheTTL)
+	log.Printf("people cache: size=%d, ttl=%s", size, ttl)
+	return NewCachedStore(store, NewLRUCache(size, ttl)), nil
+}
+
+func newBackendFromEnv() (PersonStore, error) {
+	backend := env.Get("PEOPLE_STORE", StoreMySQL)
+	log.Print("people store=" + backend)
+	switch backend {
+	case StoreMySQL:
+		return NewRepository()
+	case StoreMemory:
+		people, err := LoadFixtures(env.Get("PEOPLE_FIXTURES", ""))
+		if err != nil {
+			return nil, err
+		}
+		return NewMemoryStore(people...), nil
+	case StoreFile:
+		return NewFileStore(env.Get("PEOPLE_STORE_PATH", DefaultStorePath), env.Get("PEOPLE_FIXTURES", ""))
+	default:
+		return nil, fmt.Errorf("unknown people store %q", backend)
+	}
+}